@@ -0,0 +1,235 @@
+package sdp
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/pion/sdp/v4"
+)
+
+const (
+	rtpmapHeader = "rtpmap"
+	fmtpHeader   = "fmtp"
+	rtcpFbHeader = "rtcp-fb"
+	mediaAudio   = "audio"
+	mediaVideo   = "video"
+)
+
+// Codec describes a media format the package is able to offer and accept.
+type Codec struct {
+	Media        string // "audio" or "video", empty means "audio"
+	Name         string // encoding name as it appears in a=rtpmap, e.g. "opus"
+	PayloadType  uint8
+	ClockRate    int
+	Channels     int
+	Fmtp         string   // a=fmtp parameters without the payload type, empty if none
+	RTCPFeedback []string // a=rtcp-fb values without the payload type, e.g. "nack pli"
+	Ptime        int      // preferred packetization time in ms, 0 means ptimeDefault
+	MinPtime     int      // 0 means no lower bound
+	MaxPtime     int      // 0 means no upper bound
+}
+
+// MediaType returns the kind of m= line the codec belongs to.
+func (c Codec) MediaType() string {
+	if c.Media == "" {
+		return mediaAudio
+	}
+
+	return c.Media
+}
+
+// Format returns the payload type as used in the m= line.
+func (c Codec) Format() string {
+	return fmt.Sprint(c.PayloadType)
+}
+
+// Rtpmap returns the a=rtpmap attribute for the codec.
+func (c Codec) Rtpmap() sdp.Attribute {
+	value := fmt.Sprintf("%d %s/%d", c.PayloadType, c.Name, c.ClockRate)
+	if c.Channels > 1 {
+		value = fmt.Sprintf("%s/%d", value, c.Channels)
+	}
+
+	return sdp.Attribute{
+		Key:   rtpmapHeader,
+		Value: value,
+	}
+}
+
+// FmtpAttribute returns the a=fmtp attribute for the codec, if it has parameters.
+func (c Codec) FmtpAttribute() (sdp.Attribute, bool) {
+	if c.Fmtp == "" {
+		return sdp.Attribute{}, false
+	}
+
+	return sdp.Attribute{
+		Key:   fmtpHeader,
+		Value: fmt.Sprintf("%d %s", c.PayloadType, c.Fmtp),
+	}, true
+}
+
+// RTCPFeedbackAttributes returns the a=rtcp-fb attributes for the codec.
+func (c Codec) RTCPFeedbackAttributes() []sdp.Attribute {
+	attrs := []sdp.Attribute{}
+	for _, feedback := range c.RTCPFeedback {
+		attrs = append(attrs, sdp.Attribute{
+			Key:   rtcpFbHeader,
+			Value: fmt.Sprintf("%d %s", c.PayloadType, feedback),
+		})
+	}
+
+	return attrs
+}
+
+// CodecRegistry holds the codecs in preference order. It is safe for concurrent use.
+type CodecRegistry struct {
+	mu     sync.RWMutex
+	codecs []Codec
+}
+
+// NewCodecRegistry returns a registry with the given codecs, the first one being the most preferred.
+func NewCodecRegistry(codecs ...Codec) (*CodecRegistry, error) {
+	registry := &CodecRegistry{}
+	for _, codec := range codecs {
+		if err := registry.Register(codec); err != nil {
+			return nil, err
+		}
+	}
+
+	return registry, nil
+}
+
+// DefaultCodecRegistry returns a new registry with the codecs supported out of the box.
+func DefaultCodecRegistry() *CodecRegistry {
+	return &CodecRegistry{
+		codecs: []Codec{
+			{Name: opus, PayloadType: 106, ClockRate: 48000, Channels: 2, Fmtp: opusDefaultFmtp, MinPtime: 10, MaxPtime: 120},
+			{Name: opus, PayloadType: 105, ClockRate: 48000, Channels: 2, Fmtp: opusDefaultFmtp, MinPtime: 10, MaxPtime: 120},
+			{Name: opus, PayloadType: 96, ClockRate: 48000, Channels: 2, Fmtp: opusDefaultFmtp, MinPtime: 10, MaxPtime: 120},
+			{Name: "PCMA", PayloadType: 8, ClockRate: 8000, Channels: 1, MinPtime: 10, MaxPtime: 60},
+			{Name: "PCMU", PayloadType: 0, ClockRate: 8000, Channels: 1, MinPtime: 10, MaxPtime: 60},
+			{Name: "G722", PayloadType: 9, ClockRate: 8000, Channels: 1, MinPtime: 10, MaxPtime: 60}, // TODO: G722 - not ready. Bad audio from LK to SIP
+			{Name: telephoneEvent, PayloadType: 110, ClockRate: 48000, Channels: 1, Fmtp: telephoneEventEvents},
+			{Name: telephoneEvent, PayloadType: 101, ClockRate: 8000, Channels: 1, Fmtp: telephoneEventEvents},
+		},
+	}
+}
+
+// Register appends the codec at the lowest preference.
+// It fails if the payload type is already taken.
+func (r *CodecRegistry) Register(codec Codec) error {
+	if codec.Name == "" || codec.ClockRate <= 0 {
+		return fmt.Errorf("invalid codec %q with clock rate %d", codec.Name, codec.ClockRate)
+	}
+
+	if codec.Channels == 0 {
+		codec.Channels = 1
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, registered := range r.codecs {
+		if registered.PayloadType == codec.PayloadType {
+			return fmt.Errorf("payload type %d already registered for %s", codec.PayloadType, registered.Name)
+		}
+	}
+
+	r.codecs = append(r.codecs, codec)
+
+	return nil
+}
+
+// Unregister removes every codec with the given encoding name.
+func (r *CodecRegistry) Unregister(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	codecs := r.codecs[:0]
+	for _, codec := range r.codecs {
+		if !strings.EqualFold(codec.Name, name) {
+			codecs = append(codecs, codec)
+		}
+	}
+
+	r.codecs = codecs
+}
+
+// UnregisterPayloadType removes the codec registered with the given payload type.
+func (r *CodecRegistry) UnregisterPayloadType(payloadType uint8) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	codecs := r.codecs[:0]
+	for _, codec := range r.codecs {
+		if codec.PayloadType != payloadType {
+			codecs = append(codecs, codec)
+		}
+	}
+
+	r.codecs = codecs
+}
+
+// Lookup returns the most preferred codec with the given encoding name.
+func (r *CodecRegistry) Lookup(name string) (Codec, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, codec := range r.codecs {
+		if strings.EqualFold(codec.Name, name) {
+			return codec, true
+		}
+	}
+
+	return Codec{}, false
+}
+
+// LookupPayloadType returns the codec registered with the given payload type.
+func (r *CodecRegistry) LookupPayloadType(payloadType uint8) (Codec, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, codec := range r.codecs {
+		if codec.PayloadType == payloadType {
+			return codec, true
+		}
+	}
+
+	return Codec{}, false
+}
+
+// Codecs returns a copy of the registered codecs in preference order.
+func (r *CodecRegistry) Codecs() []Codec {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return append([]Codec(nil), r.codecs...)
+}
+
+// MediaCodecs returns the registered codecs for one kind of m= line in preference order.
+func (r *CodecRegistry) MediaCodecs(media string) []Codec {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	codecs := []Codec{}
+	for _, codec := range r.codecs {
+		if codec.MediaType() == media {
+			codecs = append(codecs, codec)
+		}
+	}
+
+	return codecs
+}
+
+// mediaTypes returns the kinds of m= line the registry has codecs for, audio first.
+func (r *CodecRegistry) mediaTypes() []string {
+	media := []string{}
+	for _, kind := range []string{mediaAudio, mediaVideo} {
+		if len(r.MediaCodecs(kind)) > 0 {
+			media = append(media, kind)
+		}
+	}
+
+	return media
+}
@@ -0,0 +1,48 @@
+package sdp
+
+import "testing"
+
+func TestCodecRegistry(t *testing.T) {
+	registry, err := NewCodecRegistry(
+		Codec{Name: "PCMA", PayloadType: 8, ClockRate: 8000},
+		Codec{Name: opus, PayloadType: 111, ClockRate: 48000, Channels: 2},
+		Codec{Name: opus, PayloadType: 96, ClockRate: 48000, Channels: 2},
+	)
+	if err != nil {
+		t.Fatalf("NewCodecRegistry: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		codec   Codec
+		wantErr bool
+	}{
+		{name: "new payload type", codec: Codec{Name: "PCMU", PayloadType: 0, ClockRate: 8000}},
+		{name: "taken payload type", codec: Codec{Name: "G722", PayloadType: 8, ClockRate: 8000}, wantErr: true},
+		{name: "without name", codec: Codec{PayloadType: 9, ClockRate: 8000}, wantErr: true},
+		{name: "without clock rate", codec: Codec{Name: "G722", PayloadType: 9}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := registry.Register(tt.codec); (err != nil) != tt.wantErr {
+				t.Fatalf("Register() error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	if codec, ok := registry.Lookup("OPUS"); !ok || codec.PayloadType != 111 {
+		t.Fatalf("Lookup(OPUS) = %d, %v, want the most preferred opus 111", codec.PayloadType, ok)
+	}
+
+	if codec, ok := registry.LookupPayloadType(0); !ok || codec.Channels != 1 {
+		t.Fatalf("LookupPayloadType(0) = %+v, %v, want PCMU with one channel", codec, ok)
+	}
+
+	registry.Unregister(opus)
+	registry.UnregisterPayloadType(8)
+
+	if codecs := registry.Codecs(); len(codecs) != 1 || codecs[0].Name != "PCMU" {
+		t.Fatalf("Codecs() = %+v, want PCMU only", codecs)
+	}
+}
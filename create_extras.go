@@ -10,8 +10,11 @@ const (
 	branchParam = "branch"
 )
 
-func CreateVIA(localSIPAddr *net.UDPAddr) *sip.ViaHeader {
+// CreateVIA returns a Via header with a new branch whose sent-by is the
+// advertised address of localSIPAddr.
+func CreateVIA(localSIPAddr *net.UDPAddr, opts ...Option) *sip.ViaHeader {
 	transport := "UDP"
+	localSIPAddr = newConfig(opts).advertisedAddr(localSIPAddr)
 
 	newVia := &sip.ViaHeader{
 		ProtocolName:    "SIP",
@@ -27,42 +30,85 @@ func CreateVIA(localSIPAddr *net.UDPAddr) *sip.ViaHeader {
 	return newVia
 }
 
-func CreateACK(req *sip.Request, resp *sip.Response, localSIPAddr *net.UDPAddr) *sip.Request {
-	contact := req.Contact().Address
+// CreateACK returns the ACK for resp to req, built with CreateACKfor2xx or
+// CreateACKforNon2xx depending on the status of resp.
+func CreateACK(req *sip.Request, resp *sip.Response, localSIPAddr *net.UDPAddr, opts ...Option) *sip.Request {
+	if resp.IsSuccess() {
+		return CreateACKfor2xx(req, resp, localSIPAddr, opts...)
+	}
+
+	return CreateACKforNon2xx(req, resp)
+}
+
+// CreateACKfor2xx returns the ACK for a 2xx response to invite as described
+// in RFC 3261 section 13.2.2.4: a new transaction with its own branch, sent
+// to the Contact of resp through the proxies in its Record-Route.
+func CreateACKfor2xx(invite *sip.Request, resp *sip.Response, localSIPAddr *net.UDPAddr, opts ...Option) *sip.Request {
+	remoteTarget := invite.Recipient
 	if resp.Contact() != nil {
-		contact = resp.Contact().Address
+		remoteTarget = resp.Contact().Address
 	}
 
-	reqToSend := sip.NewRequest(sip.ACK, contact)
-	newVia := CreateVIA(localSIPAddr)
-	if reqBranch, ok := req.Via().Params.Get(branchParam); ok {
-		newVia.Params.Add(branchParam, reqBranch)
+	ack := sip.NewRequest(sip.ACK, sip.Uri{})
+	ack.SipVersion = invite.SipVersion
+	maxForwards := sip.MaxForwardsHeader(70)
+
+	ack.AppendHeader(CreateVIA(localSIPAddr, opts...))
+	routeRequest(ack, uacRouteSet(resp), remoteTarget)
+	ack.AppendHeader(&maxForwards)
+	ack.AppendHeader(sip.HeaderClone(invite.From()))
+	ack.AppendHeader(sip.HeaderClone(resp.To()))
+	ack.AppendHeader(sip.HeaderClone(invite.CallID()))
+	ack.AppendHeader(&sip.CSeqHeader{
+		SeqNo:      invite.CSeq().SeqNo,
+		MethodName: sip.ACK,
+	})
+	ack.AppendHeader(sip.NewHeader("User-Agent", UserAgent))
+	ack.SetBody(nil)
+
+	return ack
+}
+
+// CreateACKforNon2xx returns the ACK for a 3xx-6xx response to invite as
+// described in RFC 3261 section 17.1.1.3: part of the INVITE transaction,
+// with its Request-URI, its top Via only and its Route headers.
+func CreateACKforNon2xx(invite *sip.Request, resp *sip.Response) *sip.Request {
+	ack := sip.NewRequest(sip.ACK, *invite.Recipient.Clone())
+	ack.SipVersion = invite.SipVersion
+	maxForwards := sip.MaxForwardsHeader(70)
+
+	ack.AppendHeader(invite.Via().Clone())
+
+	for _, route := range invite.GetHeaders("Route") {
+		ack.AppendHeader(sip.HeaderClone(route))
 	}
 
-	reqToSend.AppendHeader(newVia)
-	reqToSend.AppendHeader(resp.From())
-	reqToSend.AppendHeader(resp.To())
-	reqToSend.AppendHeader(resp.CallID())
-	reqToSend.AppendHeader(&sip.CSeqHeader{
-		SeqNo:      req.CSeq().SeqNo,
+	ack.AppendHeader(&maxForwards)
+	ack.AppendHeader(sip.HeaderClone(invite.From()))
+	ack.AppendHeader(sip.HeaderClone(resp.To()))
+	ack.AppendHeader(sip.HeaderClone(invite.CallID()))
+	ack.AppendHeader(&sip.CSeqHeader{
+		SeqNo:      invite.CSeq().SeqNo,
 		MethodName: sip.ACK,
 	})
-	reqToSend.AppendHeader(req.MaxForwards())
-	reqToSend.AppendHeader(sip.NewHeader("User-Agent", UserAgent))
-	reqToSend.AppendHeader(sip.NewHeader("Content-Length", "0"))
+	ack.AppendHeader(sip.NewHeader("User-Agent", UserAgent))
+	ack.SetBody(nil)
 
-	return reqToSend
+	return ack
 }
 
-func CreateBYEtoUAS(reqInvite, lastACK *sip.Request, localSIPAddr *net.UDPAddr) *sip.Request {
+// CreateBYEtoUAS returns a BYE for the call of a received reqInvite, routed
+// through the proxies that recorded themselves in it.
+func CreateBYEtoUAS(reqInvite, lastACK *sip.Request, localSIPAddr *net.UDPAddr, opts ...Option) *sip.Request {
 	reqToSend := sip.NewRequest(sip.BYE, reqInvite.Contact().Address)
 	reqToSend.SipVersion = reqInvite.SipVersion
 
 	cseq := lastACK.CSeq()
 	maxForwards := sip.MaxForwardsHeader(70)
 
-	newVia := CreateVIA(localSIPAddr)
+	newVia := CreateVIA(localSIPAddr, opts...)
 	reqToSend.AppendHeader(newVia)
+	routeRequest(reqToSend, recordRouteSet(reqInvite), reqInvite.Contact().Address)
 	reqToSend.AppendHeader(sip.NewHeader("To", lastACK.From().Value()))
 	reqToSend.AppendHeader(sip.NewHeader("From", lastACK.To().Value()))
 	reqToSend.AppendHeader(lastACK.CallID())
@@ -77,20 +123,28 @@ func CreateBYEtoUAS(reqInvite, lastACK *sip.Request, localSIPAddr *net.UDPAddr)
 	return reqToSend
 }
 
-func CreateBYEtoUAC(reqInvite, lastACK *sip.Request, localSIPAddr *net.UDPAddr) *sip.Request {
-	reqToSend := sip.NewRequest(sip.BYE, reqInvite.Contact().Address)
+// CreateBYEtoUAC returns a BYE for the call of the sent lastACK, the ACK
+// for a 2xx to reqInvite, with its From, To, Request-URI and Route headers,
+// which already follow the route set of the dialog. Its CSeq follows the one
+// of lastACK; use Dialog.CreateBYE when other requests were sent since.
+func CreateBYEtoUAC(reqInvite, lastACK *sip.Request, localSIPAddr *net.UDPAddr, opts ...Option) *sip.Request {
+	reqToSend := sip.NewRequest(sip.BYE, *lastACK.Recipient.Clone())
 	reqToSend.SipVersion = reqInvite.SipVersion
 
-	cseq := lastACK.CSeq()
 	maxForwards := sip.MaxForwardsHeader(70)
 
-	newVia := CreateVIA(localSIPAddr)
+	newVia := CreateVIA(localSIPAddr, opts...)
 	reqToSend.AppendHeader(newVia)
+
+	for _, route := range lastACK.GetHeaders("Route") {
+		reqToSend.AppendHeader(sip.HeaderClone(route))
+	}
+
 	reqToSend.AppendHeader(lastACK.To())
 	reqToSend.AppendHeader(lastACK.From())
 	reqToSend.AppendHeader(lastACK.CallID())
 	reqToSend.AppendHeader(&sip.CSeqHeader{
-		SeqNo:      cseq.SeqNo + 1,
+		SeqNo:      lastACK.CSeq().SeqNo + 1,
 		MethodName: sip.BYE,
 	})
 	reqToSend.AppendHeader(&maxForwards)
@@ -100,21 +154,64 @@ func CreateBYEtoUAC(reqInvite, lastACK *sip.Request, localSIPAddr *net.UDPAddr)
 	return reqToSend
 }
 
+// CreateCANCELtoUAC returns a CANCEL for reqInvite, built with CreateCANCEL.
+// localSIPAddr is only used for the Via when reqInvite has none, since a
+// CANCEL must otherwise carry the very Via of the request it cancels.
 func CreateCANCELtoUAC(reqInvite *sip.Request, localSIPAddr *net.UDPAddr) *sip.Request {
-	reqToSend := sip.NewRequest(sip.CANCEL, reqInvite.Recipient)
+	reqToSend := CreateCANCEL(reqInvite)
+	if reqToSend.Via() == nil {
+		reqToSend.PrependHeader(CreateVIA(localSIPAddr))
+	}
 
-	cseq := reqInvite.CSeq()
-	cseq.MethodName = sip.CANCEL
+	return reqToSend
+}
 
-	newVia := reqInvite.Via()
-	reqToSend.AppendHeader(newVia)
-	reqToSend.AppendHeader(reqInvite.MaxForwards())
-	reqToSend.AppendHeader(reqInvite.From())
-	reqToSend.AppendHeader(reqInvite.To())
-	reqToSend.AppendHeader(reqInvite.CallID())
-	reqToSend.AppendHeader(reqInvite.CSeq())
+// CreateCANCEL returns a CANCEL for req, typically a pending INVITE, as
+// described in RFC 3261 section 9.1: the same Request-URI, Call-ID, From,
+// To, CSeq number, top Via and Route headers, without modifying req.
+func CreateCANCEL(req *sip.Request) *sip.Request {
+	reqToSend := sip.NewRequest(sip.CANCEL, *req.Recipient.Clone())
+	reqToSend.SipVersion = req.SipVersion
+
+	if via := req.Via(); via != nil {
+		reqToSend.AppendHeader(via.Clone())
+	}
+
+	for _, route := range req.GetHeaders("Route") {
+		reqToSend.AppendHeader(sip.HeaderClone(route))
+	}
+
+	maxForwards := sip.MaxForwardsHeader(70)
+	if req.MaxForwards() != nil {
+		maxForwards = *req.MaxForwards()
+	}
+
+	reqToSend.AppendHeader(&maxForwards)
+	reqToSend.AppendHeader(sip.HeaderClone(req.From()))
+	reqToSend.AppendHeader(sip.HeaderClone(req.To()))
+	reqToSend.AppendHeader(sip.HeaderClone(req.CallID()))
+	reqToSend.AppendHeader(&sip.CSeqHeader{
+		SeqNo:      req.CSeq().SeqNo,
+		MethodName: sip.CANCEL,
+	})
 	reqToSend.AppendHeader(sip.NewHeader("User-Agent", UserAgent))
-	reqToSend.AppendHeader(sip.NewHeader("Content-Length", "0"))
+	reqToSend.SetBody(nil)
 
 	return reqToSend
 }
+
+// CreateRequestTerminated returns the 487 Request Terminated a UAS sends
+// for an INVITE it received a CANCEL for, after answering the CANCEL with
+// 200. toTag must be the tag of the provisional responses already sent, if
+// any. When it is empty, the To tag of a re-INVITE is kept and a new one is
+// generated otherwise.
+func CreateRequestTerminated(reqInvite *sip.Request, toTag string) *sip.Response {
+	resp := sip.NewResponseFromRequest(reqInvite, sip.StatusRequestTerminated, "Request Terminated", nil)
+	if toTag != "" && resp.To() != nil {
+		resp.To().Params.Add(tagParam, toTag)
+	}
+
+	resp.AppendHeader(sip.NewHeader("User-Agent", UserAgent))
+
+	return resp
+}
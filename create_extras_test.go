@@ -0,0 +1,193 @@
+package sdp
+
+import (
+	"net"
+	"testing"
+
+	"github.com/emiago/sipgo/sip"
+)
+
+func testURI(t *testing.T, value string) sip.Uri {
+	t.Helper()
+
+	var uri sip.Uri
+	if err := sip.ParseUri(value, &uri); err != nil {
+		t.Fatalf("parsing %q: %v", value, err)
+	}
+
+	return uri
+}
+
+// testAnswer returns a response to invite from the UAS at contact, through
+// the proxies of recordRoutes listed from the UAS side first.
+func testAnswer(t *testing.T, invite *sip.Request, status int, contact string, recordRoutes ...string) *sip.Response {
+	t.Helper()
+
+	resp := sip.NewResponseFromRequest(invite, status, "", nil)
+	resp.AppendHeader(&sip.ContactHeader{Address: testURI(t, contact)})
+
+	for _, recordRoute := range recordRoutes {
+		resp.AppendHeader(&sip.RecordRouteHeader{Address: testURI(t, recordRoute)})
+	}
+
+	return resp
+}
+
+func routeValues(msg sip.Message) []string {
+	values := []string{}
+	for _, route := range msg.GetHeaders("Route") {
+		values = append(values, route.Value())
+	}
+
+	return values
+}
+
+func TestCreateRequestTerminated(t *testing.T) {
+	reINVITE := testRequest(sip.INVITE, sip.GenerateBranch())
+	reINVITE.To().Params.Add(tagParam, "dialogtag")
+
+	tests := []struct {
+		name   string
+		invite *sip.Request
+		toTag  string
+		want   string // "" for any new tag
+	}{
+		{name: "INVITE without provisional response", invite: testRequest(sip.INVITE, sip.GenerateBranch())},
+		{name: "INVITE after a provisional response", invite: testRequest(sip.INVITE, sip.GenerateBranch()), toTag: "ringing", want: "ringing"},
+		{name: "re-INVITE", invite: reINVITE, want: "dialogtag"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := CreateRequestTerminated(tt.invite, tt.toTag)
+			if resp.StatusCode != sip.StatusRequestTerminated {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, sip.StatusRequestTerminated)
+			}
+
+			tag, ok := resp.To().Params.Get(tagParam)
+			if !ok || tag == "" || tt.want != "" && tag != tt.want {
+				t.Fatalf("To tag = %q, want %q", tag, tt.want)
+			}
+
+			if resp.GetHeader("User-Agent") == nil {
+				t.Fatal("response without User-Agent")
+			}
+		})
+	}
+}
+
+func TestCreateBYEtoUAC(t *testing.T) {
+	localSIPAddr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 5070}
+
+	invite := testRequest(sip.INVITE, sip.GenerateBranch())
+	invite.CSeq().SeqNo = 7
+
+	resp := testAnswer(t, invite, sip.StatusOK, "sip:bob@192.0.2.2:5060", "sip:p2.example.com;lr", "sip:p1.example.com;lr")
+	ack := CreateACKfor2xx(invite, resp, localSIPAddr)
+	bye := CreateBYEtoUAC(invite, ack, localSIPAddr)
+
+	if bye.Recipient.String() != ack.Recipient.String() {
+		t.Fatalf("Request-URI = %s, want %s", bye.Recipient.String(), ack.Recipient.String())
+	}
+
+	if got, want := routeValues(bye), routeValues(ack); len(got) != 2 || got[0] != want[0] || got[1] != want[1] {
+		t.Fatalf("Route = %v, want %v", got, want)
+	}
+
+	if bye.From().Value() != invite.From().Value() || bye.To().Value() != resp.To().Value() {
+		t.Fatalf("From %s and To %s, want those of the INVITE and its answer", bye.From().Value(), bye.To().Value())
+	}
+
+	if cseq := bye.CSeq(); cseq.SeqNo != 8 || cseq.MethodName != sip.BYE {
+		t.Fatalf("CSeq = %s, want 8 BYE", cseq.Value())
+	}
+}
+
+func TestCreateACK(t *testing.T) {
+	localSIPAddr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 5070}
+
+	invite := testRequest(sip.INVITE, sip.GenerateBranch())
+	invite.AppendHeader(&sip.RouteHeader{Address: testURI(t, "sip:192.0.2.11;lr")})
+	invite.AppendHeader(CreateVIA(&net.UDPAddr{IP: net.IPv4(192, 0, 2, 9), Port: 5060}))
+	invite.CSeq().SeqNo = 3
+	branch, _ := invite.Via().Params.Get(branchParam)
+
+	t.Run("non-2xx", func(t *testing.T) {
+		resp := testAnswer(t, invite, sip.StatusBusyHere, "sip:bob@192.0.2.2:5060")
+		ack := CreateACK(invite, resp, localSIPAddr)
+
+		if vias := ack.GetHeaders("Via"); len(vias) != 1 {
+			t.Fatalf("%d Via headers, want 1", len(vias))
+		}
+
+		if ackBranch, _ := ack.Via().Params.Get(branchParam); ackBranch != branch {
+			t.Fatalf("branch = %s, want the one of the INVITE %s", ackBranch, branch)
+		}
+
+		if ack.Recipient.String() != invite.Recipient.String() {
+			t.Fatalf("Request-URI = %s, want %s", ack.Recipient.String(), invite.Recipient.String())
+		}
+
+		if routes := routeValues(ack); len(routes) != 1 || routes[0] != "<sip:192.0.2.11;lr>" {
+			t.Fatalf("Route = %v, want the one of the INVITE", routes)
+		}
+
+		if ack.To().Value() != resp.To().Value() || ack.CSeq().SeqNo != 3 || ack.CSeq().MethodName != sip.ACK {
+			t.Fatalf("To %s and CSeq %s, want the To of the response and 3 ACK", ack.To().Value(), ack.CSeq().Value())
+		}
+	})
+
+	t.Run("2xx", func(t *testing.T) {
+		resp := testAnswer(t, invite, sip.StatusOK, "sip:bob@192.0.2.2:5060", "sip:192.0.2.12;lr", "sip:192.0.2.11;lr")
+		ack := CreateACK(invite, resp, localSIPAddr)
+
+		if ackBranch, _ := ack.Via().Params.Get(branchParam); ackBranch == branch {
+			t.Fatal("ACK for a 2xx reuses the branch of the INVITE")
+		}
+
+		if ack.Recipient.String() != "sip:bob@192.0.2.2:5060" {
+			t.Fatalf("Request-URI = %s, want the Contact of the response", ack.Recipient.String())
+		}
+
+		if routes := routeValues(ack); len(routes) != 2 || routes[0] != "<sip:192.0.2.11;lr>" || routes[1] != "<sip:192.0.2.12;lr>" {
+			t.Fatalf("Route = %v, want the Record-Route of the response reversed", routes)
+		}
+
+		if ack.To().Value() != resp.To().Value() || ack.CSeq().SeqNo != 3 || ack.CSeq().MethodName != sip.ACK {
+			t.Fatalf("To %s and CSeq %s, want the To of the response and 3 ACK", ack.To().Value(), ack.CSeq().Value())
+		}
+	})
+}
+
+func TestCreateCANCEL(t *testing.T) {
+	invite := testRequest(sip.INVITE, sip.GenerateBranch())
+	invite.AppendHeader(&sip.RouteHeader{Address: testURI(t, "sip:192.0.2.11;lr")})
+	invite.CSeq().SeqNo = 42
+	branch, _ := invite.Via().Params.Get(branchParam)
+
+	cancel := CreateCANCEL(invite)
+
+	if cseq := invite.CSeq(); cseq.SeqNo != 42 || cseq.MethodName != sip.INVITE {
+		t.Fatalf("INVITE CSeq changed to %s", cseq.Value())
+	}
+
+	if cseq := cancel.CSeq(); cseq.SeqNo != 42 || cseq.MethodName != sip.CANCEL {
+		t.Fatalf("CSeq = %s, want 42 CANCEL", cseq.Value())
+	}
+
+	if cancelBranch, _ := cancel.Via().Params.Get(branchParam); cancelBranch != branch {
+		t.Fatalf("branch = %s, want the one of the INVITE %s", cancelBranch, branch)
+	}
+
+	if cancel.Recipient.String() != invite.Recipient.String() {
+		t.Fatalf("Request-URI = %s, want %s", cancel.Recipient.String(), invite.Recipient.String())
+	}
+
+	if routes := routeValues(cancel); len(routes) != 1 || routes[0] != "<sip:192.0.2.11;lr>" {
+		t.Fatalf("Route = %v, want the one of the INVITE", routes)
+	}
+
+	if cancel.From().Value() != invite.From().Value() || cancel.To().Value() != invite.To().Value() {
+		t.Fatalf("From %s and To %s, want those of the INVITE", cancel.From().Value(), cancel.To().Value())
+	}
+}
@@ -20,20 +20,44 @@ type UsersManager interface {
 // 2. the created INVITE request,
 // 3. the address of the user the request should be sent to,
 // 4. and an error if any.
-func CreateINVITE(connSIP *net.UDPConn, rtpHost string, req *sip.Request, addrTo *net.UDPAddr) (*net.UDPConn, *net.UDPConn, *sip.Request, error) {
-	inviteReq, connRTP, connRTCP, err := createInviteOutgoing(
+func CreateINVITE(connSIP *net.UDPConn, rtpHost string, req *sip.Request, addrTo *net.UDPAddr, opts ...Option) (*net.UDPConn, *net.UDPConn, *sip.Request, error) {
+	cfg := newConfig(opts)
+	cfg.offerMedia = []string{mediaAudio}
+
+	inviteReq, streams, err := createInviteOutgoing(
 		connSIP,
 		rtpHost,
 		req.MaxForwards().Val(),
 		req.From(),
 		req.To(),
 		addrTo,
+		cfg,
 	)
 	if err != nil {
 		return nil, nil, nil, fmt.Errorf("handling INVITE to the other user: %w", err)
 	}
 
-	return connRTP, connRTCP, inviteReq, nil
+	return streams[0].ConnRTP, streams[0].ConnRTCP, inviteReq, nil
+}
+
+// CreateINVITEStreams is like CreateINVITE but offers one m= line per kind
+// of media in the codec registry, e.g. audio and video, and returns the
+// connections allocated for each of them.
+func CreateINVITEStreams(connSIP *net.UDPConn, rtpHost string, req *sip.Request, addrTo *net.UDPAddr, opts ...Option) (*sip.Request, []StreamResult, error) {
+	inviteReq, streams, err := createInviteOutgoing(
+		connSIP,
+		rtpHost,
+		req.MaxForwards().Val(),
+		req.From(),
+		req.To(),
+		addrTo,
+		newConfig(opts),
+	)
+	if err != nil {
+		return nil, nil, fmt.Errorf("handling INVITE to the other user: %w", err)
+	}
+
+	return inviteReq, streams, nil
 }
 
 func createInviteOutgoing(
@@ -43,8 +67,9 @@ func createInviteOutgoing(
 	headerFrom *sip.FromHeader,
 	headerTo *sip.ToHeader,
 	addrTo *net.UDPAddr,
-) (*sip.Request, *net.UDPConn, *net.UDPConn, error) {
-	localSIPAddr := connSIP.LocalAddr().(*net.UDPAddr)
+	cfg *config,
+) (*sip.Request, []StreamResult, error) {
+	localSIPAddr := cfg.advertisedAddr(connSIP.LocalAddr().(*net.UDPAddr))
 	udpAddrTo := addrTo
 
 	reqInviteTo := sip.NewRequest(sip.INVITE, sip.Uri{
@@ -53,9 +78,9 @@ func createInviteOutgoing(
 		Host:   udpAddrTo.IP.String(),
 		Port:   udpAddrTo.Port,
 	})
-	toSendSDP, connRTP, connRTCP, err := generateLocalSDP(connSIP, rtpHost)
+	toSendSDP, streams, err := generateLocalSDP(connSIP, rtpHost, cfg)
 	if err != nil {
-		return nil, nil, nil, fmt.Errorf("generating local SDP: %w", err)
+		return nil, nil, fmt.Errorf("generating local SDP: %w", err)
 	}
 
 	reqInviteTo.SetBody(toSendSDP)
@@ -102,5 +127,5 @@ func createInviteOutgoing(
 	reqInviteTo.AppendHeader(sip.NewHeader("Content-Type", "application/sdp"))
 	reqInviteTo.AppendHeader(sip.NewHeader("Accept", "application/sdp"))
 
-	return reqInviteTo, connRTP, connRTCP, nil
+	return reqInviteTo, streams, nil
 }
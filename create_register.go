@@ -68,6 +68,15 @@ func AuthRequest(wwwAuth string, creds *Credentials, req *sip.Request) (*sip.Req
 		return nil, fmt.Errorf("failed to parse challenge wwwauth %s: %w", wwwAuth, err)
 	}
 
+	defaultLogger().Debug("answering digest challenge",
+		"method", req.Method,
+		"realm", challenge.Realm,
+		"algorithm", challenge.Algorithm,
+		"qop", challenge.QOP,
+		"stale", challenge.Stale,
+		"cseq", cseq.SeqNo,
+	)
+
 	solution, err := digest.Digest(challenge, digest.Options{
 		Method:   req.Method.String(),
 		URI:      creds.Host,
@@ -83,14 +92,17 @@ func AuthRequest(wwwAuth string, creds *Credentials, req *sip.Request) (*sip.Req
 	return reqAuthenticated, nil
 }
 
-func CreateREGISTER(creds *Credentials, callID string, lAddr *net.UDPAddr) (*sip.Request, error) {
+func CreateREGISTER(creds *Credentials, callID string, lAddr *net.UDPAddr, opts ...Option) (*sip.Request, error) {
 	reqRegister := sip.NewRequest(sip.REGISTER, sip.Uri{
 		Scheme: scheme,
 		Host:   creds.Host,
 		Port:   creds.Port,
 	})
 
-	via := CreateVIA(lAddr)
+	cfg := newConfig(opts)
+	advertisedAddr := cfg.advertisedAddr(lAddr)
+
+	via := CreateVIA(advertisedAddr)
 	maxForwards := sip.NewHeader("Max-Forwards", "70")
 	route := &sip.RouteHeader{
 		Address: sip.Uri{
@@ -108,8 +120,8 @@ func CreateREGISTER(creds *Credentials, callID string, lAddr *net.UDPAddr) (*sip
 	contact := &sip.ContactHeader{
 		Address: sip.Uri{
 			Scheme:    scheme,
-			Host:      lAddr.IP.String(),
-			Port:      lAddr.Port,
+			Host:      advertisedAddr.IP.String(),
+			Port:      advertisedAddr.Port,
 			User:      creds.Username,
 			UriParams: sip.NewParams().Add("ob", ""),
 		},
@@ -147,5 +159,12 @@ func CreateREGISTER(creds *Credentials, callID string, lAddr *net.UDPAddr) (*sip
 	reqRegister.AppendHeader(from)
 	reqRegister.AppendHeader(to)
 
+	cfg.logger.Debug("created REGISTER",
+		"registrar", reqRegister.Recipient.String(),
+		"contact", contact.Address.String(),
+		"call_id", newCallId.Value(),
+		"cseq", cseq.SeqNo,
+	)
+
 	return reqRegister, nil
 }
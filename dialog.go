@@ -0,0 +1,404 @@
+package sdp
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"sync"
+
+	"github.com/emiago/sipgo/sip"
+)
+
+const tagParam = "tag"
+
+var (
+	// ErrNoDialog is returned when an INVITE and its response cannot
+	// establish a dialog, e.g. the response is not a 2xx or lacks a tag.
+	ErrNoDialog = errors.New("no dialog")
+	// ErrCSeqOutOfOrder is returned for an in-dialog request whose CSeq is
+	// lower than the last one received. It must be answered with 500.
+	ErrCSeqOutOfOrder = errors.New("CSeq out of order")
+)
+
+// Dialog is the state that RFC 3261 section 12 keeps for a call established
+// with an INVITE and its 2xx response, and from which every later request of
+// the call is built. It is safe for concurrent use.
+type Dialog struct {
+	mu sync.Mutex
+
+	localSIPAddr *net.UDPAddr
+	opts         []Option
+
+	callID         string
+	local          sip.FromHeader // local URI and tag
+	remote         sip.ToHeader   // remote URI and tag
+	localContact   sip.Uri
+	localSeq       uint32
+	remoteSeq      uint32
+	remoteSeqKnown bool
+	inviteSeq      uint32 // of the last INVITE sent, acknowledged by CreateACK
+	routeSet       []sip.Uri
+	remoteTarget   sip.Uri
+	isUAC          bool
+}
+
+// NewDialogUAC returns the dialog established by an INVITE sent from
+// localSIPAddr and the 2xx response it got.
+func NewDialogUAC(invite *sip.Request, resp *sip.Response, localSIPAddr *net.UDPAddr, opts ...Option) (*Dialog, error) {
+	if err := checkDialogPair(invite, resp); err != nil {
+		return nil, err
+	}
+
+	remoteTag, ok := resp.To().Params.Get(tagParam)
+	if !ok || resp.Contact() == nil {
+		return nil, fmt.Errorf("%d response without To tag or Contact: %w", resp.StatusCode, ErrNoDialog)
+	}
+
+	localTag, _ := invite.From().Params.Get(tagParam)
+
+	d := &Dialog{
+		localSIPAddr: localSIPAddr,
+		opts:         opts,
+		callID:       invite.CallID().Value(),
+		local:        sip.FromHeader{DisplayName: invite.From().DisplayName, Address: *invite.From().Address.Clone()},
+		remote:       sip.ToHeader{DisplayName: invite.To().DisplayName, Address: *invite.To().Address.Clone()},
+		localSeq:     invite.CSeq().SeqNo,
+		inviteSeq:    invite.CSeq().SeqNo,
+		routeSet:     uacRouteSet(resp),
+		remoteTarget: *resp.Contact().Address.Clone(),
+		isUAC:        true,
+	}
+
+	d.local.Params = sip.NewParams().Add(tagParam, localTag)
+	d.remote.Params = sip.NewParams().Add(tagParam, remoteTag)
+	d.setLocalContact(invite.Contact())
+
+	return d, nil
+}
+
+// NewDialogUAS returns the dialog established by a received INVITE and the
+// 2xx response sent for it from localSIPAddr.
+func NewDialogUAS(invite *sip.Request, resp *sip.Response, localSIPAddr *net.UDPAddr, opts ...Option) (*Dialog, error) {
+	if err := checkDialogPair(invite, resp); err != nil {
+		return nil, err
+	}
+
+	localTag, ok := resp.To().Params.Get(tagParam)
+	if !ok || invite.Contact() == nil {
+		return nil, fmt.Errorf("INVITE without Contact or %d response without To tag: %w", resp.StatusCode, ErrNoDialog)
+	}
+
+	remoteTag, _ := invite.From().Params.Get(tagParam)
+
+	d := &Dialog{
+		localSIPAddr:   localSIPAddr,
+		opts:           opts,
+		callID:         invite.CallID().Value(),
+		local:          sip.FromHeader{DisplayName: invite.To().DisplayName, Address: *invite.To().Address.Clone()},
+		remote:         sip.ToHeader{DisplayName: invite.From().DisplayName, Address: *invite.From().Address.Clone()},
+		localSeq:       1 + rand.Uint32N(maxV),
+		remoteSeq:      invite.CSeq().SeqNo,
+		remoteSeqKnown: true,
+		routeSet:       recordRouteSet(invite),
+		remoteTarget:   *invite.Contact().Address.Clone(),
+	}
+
+	d.local.Params = sip.NewParams().Add(tagParam, localTag)
+	d.remote.Params = sip.NewParams().Add(tagParam, remoteTag)
+	d.setLocalContact(resp.Contact())
+
+	return d, nil
+}
+
+// checkDialogPair verifies that resp is a 2xx answering invite.
+func checkDialogPair(invite *sip.Request, resp *sip.Response) error {
+	if !invite.IsInvite() || invite.CallID() == nil || invite.CSeq() == nil || invite.From() == nil || invite.To() == nil {
+		return fmt.Errorf("%s is not a complete INVITE: %w", invite.Method, ErrNoDialog)
+	}
+
+	if !resp.IsSuccess() || resp.To() == nil || resp.CallID() == nil {
+		return fmt.Errorf("%d response: %w", resp.StatusCode, ErrNoDialog)
+	}
+
+	if resp.CallID().Value() != invite.CallID().Value() {
+		return fmt.Errorf("response to Call-ID %s instead of %s: %w", resp.CallID().Value(), invite.CallID().Value(), ErrNoDialog)
+	}
+
+	return nil
+}
+
+func (d *Dialog) setLocalContact(contact *sip.ContactHeader) {
+	if contact != nil {
+		d.localContact = *contact.Address.Clone()
+
+		return
+	}
+
+	localSIPAddr := newConfig(d.opts).advertisedAddr(d.localSIPAddr)
+	d.localContact = sip.Uri{
+		Scheme: scheme,
+		User:   d.local.Address.User,
+		Host:   localSIPAddr.IP.String(),
+		Port:   localSIPAddr.Port,
+	}
+}
+
+// CallID returns the Call-ID of the dialog.
+func (d *Dialog) CallID() string {
+	return d.callID
+}
+
+// LocalTag returns the tag the local side put in From or To.
+func (d *Dialog) LocalTag() string {
+	tag, _ := d.local.Params.Get(tagParam)
+
+	return tag
+}
+
+// RemoteTag returns the tag of the remote side.
+func (d *Dialog) RemoteTag() string {
+	tag, _ := d.remote.Params.Get(tagParam)
+
+	return tag
+}
+
+// LocalSeq returns the CSeq number of the last request built by the dialog.
+func (d *Dialog) LocalSeq() uint32 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.localSeq
+}
+
+// RemoteSeq returns the CSeq number of the last request received, 0 if
+// none is known yet.
+func (d *Dialog) RemoteSeq() uint32 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.remoteSeq
+}
+
+// RouteSet returns the URIs the requests of the dialog are routed through,
+// first hop first: the Record-Route of the 2xx reversed for a UAC, and that
+// of the INVITE for a UAS.
+func (d *Dialog) RouteSet() []sip.Uri {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	routeSet := make([]sip.Uri, len(d.routeSet))
+	for i, uri := range d.routeSet {
+		routeSet[i] = *uri.Clone()
+	}
+
+	return routeSet
+}
+
+// RemoteTarget returns the Contact of the remote side.
+func (d *Dialog) RemoteTarget() sip.Uri {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return *d.remoteTarget.Clone()
+}
+
+// NextHop returns the address the requests of the dialog are sent to: the
+// first hop of the route set, or the remote target when it is empty.
+func (d *Dialog) NextHop() (*net.UDPAddr, error) {
+	d.mu.Lock()
+	uri := *d.remoteTarget.Clone()
+	if len(d.routeSet) > 0 {
+		uri = *d.routeSet[0].Clone()
+	}
+	d.mu.Unlock()
+
+	return resolveURI(uri)
+}
+
+// IsUAC reports whether the dialog was established by a local INVITE.
+func (d *Dialog) IsUAC() bool {
+	return d.isUAC
+}
+
+// Matches reports whether msg belongs to the dialog, by its Call-ID and
+// tags.
+func (d *Dialog) Matches(msg sip.Message) bool {
+	if msg.CallID() == nil || msg.From() == nil || msg.To() == nil || msg.CallID().Value() != d.callID {
+		return false
+	}
+
+	fromTag, _ := msg.From().Params.Get(tagParam)
+	toTag, _ := msg.To().Params.Get(tagParam)
+
+	if _, ok := msg.(*sip.Response); ok {
+		return fromTag == d.LocalTag() && toTag == d.RemoteTag()
+	}
+
+	return fromTag == d.RemoteTag() && toTag == d.LocalTag()
+}
+
+// ReceiveRequest updates the dialog with a request from the remote side,
+// as described in RFC 3261 section 12.2.2: its CSeq must not go backwards,
+// and a re-INVITE or UPDATE with a Contact refreshes the remote target.
+func (d *Dialog) ReceiveRequest(req *sip.Request) error {
+	if !d.Matches(req) || req.CSeq() == nil {
+		return fmt.Errorf("%s outside the dialog %s: %w", req.Method, d.callID, ErrNoDialog)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	seqNo := req.CSeq().SeqNo
+
+	if req.Method != sip.ACK && req.Method != sip.CANCEL {
+		if d.remoteSeqKnown && seqNo < d.remoteSeq {
+			return fmt.Errorf("%s with CSeq %d after %d: %w", req.Method, seqNo, d.remoteSeq, ErrCSeqOutOfOrder)
+		}
+
+		d.remoteSeq = seqNo
+		d.remoteSeqKnown = true
+	}
+
+	if isTargetRefresh(req.Method) && req.Contact() != nil {
+		d.remoteTarget = *req.Contact().Address.Clone()
+	}
+
+	return nil
+}
+
+// ReceiveResponse refreshes the remote target with the Contact of a 2xx to
+// a re-INVITE or UPDATE.
+func (d *Dialog) ReceiveResponse(resp *sip.Response) {
+	if !resp.IsSuccess() || resp.CSeq() == nil || resp.Contact() == nil || !d.Matches(resp) {
+		return
+	}
+
+	if !isTargetRefresh(resp.CSeq().MethodName) {
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.remoteTarget = *resp.Contact().Address.Clone()
+}
+
+// CreateACK returns the ACK for a 2xx response to the last INVITE of the
+// dialog, with a new branch, as described in RFC 3261 section 13.2.2.4. body
+// carries the answer when the INVITE was offerless, and is empty otherwise.
+func (d *Dialog) CreateACK(contentType string, body []byte) *sip.Request {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	req := d.newRequest(sip.ACK, d.inviteSeq)
+	setBody(req, contentType, body)
+
+	return req
+}
+
+// CreateBYE returns a BYE ending the dialog.
+func (d *Dialog) CreateBYE() *sip.Request {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.newRequest(sip.BYE, d.nextSeq())
+}
+
+// CreateReINVITE returns an INVITE carrying the SDP in body, or an offerless
+// one when body is empty. CreateACK then acknowledges its 2xx.
+func (d *Dialog) CreateReINVITE(body []byte) *sip.Request {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.inviteSeq = d.nextSeq()
+	req := d.newRequest(sip.INVITE, d.inviteSeq)
+	setBody(req, "application/sdp", body)
+
+	return req
+}
+
+// CreateUPDATE returns an UPDATE of RFC 3311 carrying the SDP in body, or
+// none when body is empty.
+func (d *Dialog) CreateUPDATE(body []byte) *sip.Request {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	req := d.newRequest(sip.UPDATE, d.nextSeq())
+	setBody(req, "application/sdp", body)
+
+	return req
+}
+
+// CreateINFO returns an INFO of RFC 6086 carrying body, e.g.
+// application/dtmf-relay.
+func (d *Dialog) CreateINFO(contentType string, body []byte) *sip.Request {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	req := d.newRequest(sip.INFO, d.nextSeq())
+	setBody(req, contentType, body)
+
+	return req
+}
+
+// nextSeq must be called with mu held.
+func (d *Dialog) nextSeq() uint32 {
+	d.localSeq++
+
+	return d.localSeq
+}
+
+// newRequest builds an in-dialog request as described in RFC 3261 section
+// 12.2.1.1, to be sent to its NextHop. It must be called with mu held.
+func (d *Dialog) newRequest(method sip.RequestMethod, seqNo uint32) *sip.Request {
+	req := sip.NewRequest(method, sip.Uri{})
+
+	from := &sip.FromHeader{
+		DisplayName: d.local.DisplayName,
+		Address:     *d.local.Address.Clone(),
+		Params:      d.local.Params.Clone(),
+	}
+	to := &sip.ToHeader{
+		DisplayName: d.remote.DisplayName,
+		Address:     *d.remote.Address.Clone(),
+		Params:      d.remote.Params.Clone(),
+	}
+	callID := sip.CallIDHeader(d.callID)
+	maxForwards := sip.MaxForwardsHeader(70)
+
+	req.AppendHeader(CreateVIA(d.localSIPAddr, d.opts...))
+	routeRequest(req, d.routeSet, d.remoteTarget)
+
+	req.AppendHeader(&maxForwards)
+	req.AppendHeader(from)
+	req.AppendHeader(to)
+	req.AppendHeader(&callID)
+	req.AppendHeader(&sip.CSeqHeader{SeqNo: seqNo, MethodName: method})
+
+	if isTargetRefresh(method) {
+		req.AppendHeader(&sip.ContactHeader{Address: *d.localContact.Clone()})
+	}
+
+	req.AppendHeader(sip.NewHeader("User-Agent", UserAgent))
+	req.SetBody(nil)
+
+	return req
+}
+
+// setBody sets the body of req along with its Content-Type, if body is not
+// empty.
+func setBody(req *sip.Request, contentType string, body []byte) {
+	if len(body) == 0 {
+		return
+	}
+
+	req.AppendHeader(sip.NewHeader("Content-Type", contentType))
+	req.SetBody(body)
+}
+
+// isTargetRefresh reports whether method may change the remote target, see
+// RFC 3261 section 12.2 and RFC 3311.
+func isTargetRefresh(method sip.RequestMethod) bool {
+	return method == sip.INVITE || method == sip.UPDATE
+}
@@ -0,0 +1,115 @@
+package sdp
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/emiago/sipgo/sip"
+)
+
+// testDialogPair returns an INVITE from alice to bob, through the proxies of
+// recordRoutes listed as they appear at bob, and bob's 200 for it.
+func testDialogPair(t *testing.T, recordRoutes ...string) (*sip.Request, *sip.Response) {
+	t.Helper()
+
+	invite := testRequest(sip.INVITE, sip.GenerateBranch())
+	invite.From().Params.Add(tagParam, "alice-tag")
+	invite.AppendHeader(&sip.ContactHeader{Address: testURI(t, "sip:alice@192.0.2.1:5070")})
+
+	for _, recordRoute := range recordRoutes {
+		invite.AppendHeader(&sip.RecordRouteHeader{Address: testURI(t, recordRoute)})
+	}
+
+	resp := sip.NewResponseFromRequest(invite, sip.StatusOK, "OK", nil)
+	resp.To().Params.Add(tagParam, "bob-tag")
+	resp.AppendHeader(&sip.ContactHeader{Address: testURI(t, "sip:bob@192.0.2.2:5060")})
+
+	return invite, resp
+}
+
+func TestDialogCSeq(t *testing.T) {
+	localSIPAddr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 5070}
+
+	invite, resp := testDialogPair(t)
+	invite.CSeq().SeqNo = 10
+
+	dialog, err := NewDialogUAC(invite, resp, localSIPAddr)
+	if err != nil {
+		t.Fatalf("NewDialogUAC: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		create func() *sip.Request
+		method sip.RequestMethod
+		seqNo  uint32
+	}{
+		{name: "ACK of the INVITE", create: func() *sip.Request { return dialog.CreateACK("", nil) }, method: sip.ACK, seqNo: 10},
+		{name: "re-INVITE", create: func() *sip.Request { return dialog.CreateReINVITE(nil) }, method: sip.INVITE, seqNo: 11},
+		{name: "ACK of the re-INVITE", create: func() *sip.Request { return dialog.CreateACK("application/sdp", []byte("v=0")) }, method: sip.ACK, seqNo: 11},
+		{name: "INFO", create: func() *sip.Request { return dialog.CreateINFO("application/dtmf-relay", []byte("Signal=1")) }, method: sip.INFO, seqNo: 12},
+		{name: "BYE", create: func() *sip.Request { return dialog.CreateBYE() }, method: sip.BYE, seqNo: 13},
+	}
+
+	for _, tt := range tests {
+		req := tt.create()
+		if cseq := req.CSeq(); cseq.SeqNo != tt.seqNo || cseq.MethodName != tt.method {
+			t.Fatalf("%s: CSeq = %s, want %d %s", tt.name, cseq.Value(), tt.seqNo, tt.method)
+		}
+
+		if req.From().Value() != invite.From().Value() || req.To().Value() != resp.To().Value() {
+			t.Fatalf("%s: From %s and To %s, want those of the INVITE and its answer", tt.name, req.From().Value(), req.To().Value())
+		}
+	}
+
+	if ack := dialog.CreateACK("application/sdp", []byte("v=0")); string(ack.Body()) != "v=0" || ack.ContentType() == nil {
+		t.Fatal("ACK without the answer to an offerless re-INVITE")
+	}
+}
+
+func TestDialogReceiveRequest(t *testing.T) {
+	localSIPAddr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 5060}
+
+	invite, resp := testDialogPair(t)
+	invite.CSeq().SeqNo = 5
+
+	dialog, err := NewDialogUAS(invite, resp, localSIPAddr)
+	if err != nil {
+		t.Fatalf("NewDialogUAS: %v", err)
+	}
+
+	request := func(method sip.RequestMethod, seqNo uint32) *sip.Request {
+		req := testRequest(method, sip.GenerateBranch())
+		req.From().Params.Add(tagParam, "alice-tag")
+		req.To().Params.Add(tagParam, "bob-tag")
+		req.CSeq().SeqNo = seqNo
+
+		return req
+	}
+
+	outside := request(sip.BYE, 9)
+	outside.To().Params.Add(tagParam, "other-tag")
+
+	tests := []struct {
+		name    string
+		req     *sip.Request
+		wantErr error
+	}{
+		{name: "ACK of the INVITE", req: request(sip.ACK, 5)},
+		{name: "INFO", req: request(sip.INFO, 6)},
+		{name: "INFO out of order", req: request(sip.INFO, 4), wantErr: ErrCSeqOutOfOrder},
+		{name: "other dialog", req: outside, wantErr: ErrNoDialog},
+		{name: "BYE", req: request(sip.BYE, 7)},
+	}
+
+	for _, tt := range tests {
+		if err := dialog.ReceiveRequest(tt.req); !errors.Is(err, tt.wantErr) || tt.wantErr == nil && err != nil {
+			t.Fatalf("%s: ReceiveRequest() error = %v, want %v", tt.name, err, tt.wantErr)
+		}
+	}
+
+	if dialog.RemoteSeq() != 7 {
+		t.Fatalf("RemoteSeq() = %d, want 7", dialog.RemoteSeq())
+	}
+}
@@ -0,0 +1,123 @@
+package sdp
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/pion/sdp/v4"
+)
+
+// Direction is the media direction attribute of RFC 3264 section 5.1, seen
+// from the side that wrote the description.
+type Direction string
+
+const (
+	DirectionSendRecv Direction = "sendrecv"
+	DirectionSendOnly Direction = "sendonly"
+	DirectionRecvOnly Direction = "recvonly"
+	DirectionInactive Direction = "inactive"
+)
+
+func newDirection(send, recv bool) Direction {
+	switch {
+	case send && recv:
+		return DirectionSendRecv
+	case send:
+		return DirectionSendOnly
+	case recv:
+		return DirectionRecvOnly
+	}
+
+	return DirectionInactive
+}
+
+// Sends reports whether media flows out of the side that wrote the direction.
+func (d Direction) Sends() bool {
+	return d == DirectionSendRecv || d == DirectionSendOnly
+}
+
+// Receives reports whether media flows into the side that wrote the direction.
+func (d Direction) Receives() bool {
+	return d == DirectionSendRecv || d == DirectionRecvOnly
+}
+
+// Reverse returns the direction as seen from the other side.
+func (d Direction) Reverse() Direction {
+	return newDirection(d.Receives(), d.Sends())
+}
+
+// answer returns the direction to put in the answer to an offer with the
+// given direction, restricted to what the local side is willing to do.
+func (d Direction) answer(local Direction) Direction {
+	return newDirection(local.Sends() && d.Receives(), local.Receives() && d.Sends())
+}
+
+func (d Direction) attribute() sdp.Attribute {
+	return sdp.Attribute{Key: string(d)}
+}
+
+func isDirection(key string) bool {
+	switch Direction(key) {
+	case DirectionSendRecv, DirectionSendOnly, DirectionRecvOnly, DirectionInactive:
+		return true
+	}
+
+	return false
+}
+
+// parseDirection returns the direction of the m= line, which overrides the
+// session-level one, defaulting to sendrecv. A c= address of 0.0.0.0 is the
+// RFC 2543 way of putting a call on hold and removes the receive side.
+func parseDirection(desc *sdp.SessionDescription, md *sdp.MediaDescription) Direction {
+	direction := DirectionSendRecv
+
+	for _, attr := range desc.Attributes {
+		if isDirection(attr.Key) {
+			direction = Direction(attr.Key)
+		}
+	}
+
+	for _, attr := range md.Attributes {
+		if isDirection(attr.Key) {
+			direction = Direction(attr.Key)
+		}
+	}
+
+	if isLegacyHold(desc, md) {
+		direction = newDirection(direction.Sends(), false)
+	}
+
+	return direction
+}
+
+func isLegacyHold(desc *sdp.SessionDescription, md *sdp.MediaDescription) bool {
+	connection := desc.ConnectionInformation
+	if md.ConnectionInformation != nil {
+		connection = md.ConnectionInformation
+	}
+
+	if connection == nil || connection.Address == nil {
+		return false
+	}
+
+	ip := net.ParseIP(connection.Address.Address)
+
+	return ip != nil && ip.IsUnspecified()
+}
+
+// ObtainDirection returns the direction of the first m= line of the body as
+// written by its author. Applied to the answer built by NegotiateSDP or
+// RenegotiateSDP it tells what the local side should do; applied to a remote
+// answer, its Reverse does.
+func ObtainDirection(body []byte) (Direction, error) {
+	desc, err := unmarshalSDP(body)
+	if err != nil {
+		return "", fmt.Errorf("unmarshaling SDP: %w", err)
+	}
+
+	if len(desc.MediaDescriptions) == 0 {
+		return "", fmt.Errorf("no media descriptions in SDP")
+	}
+
+	return parseDirection(desc, desc.MediaDescriptions[0]), nil
+}
@@ -0,0 +1,504 @@
+package sdp
+
+import (
+	"context"
+	"crypto"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pion/dtls/v3"
+	"github.com/pion/dtls/v3/pkg/crypto/selfsign"
+	"github.com/pion/sdp/v4"
+)
+
+const (
+	protoDTLS         = "UDP/TLS/RTP/SAVPF"
+	fingerprintHeader = "fingerprint"
+	setupHeader       = "setup"
+	dtlsSRTPLabel     = "EXTRACTOR-dtls_srtp"
+	dtlsPacketBuffer  = 16
+	// dtlsHandOffAttempts bounds, in milliseconds, the wait for the DTLS
+	// connection to stop reading the media connection.
+	dtlsHandOffAttempts = 100
+)
+
+// SetupRole is the value of an a=setup attribute (RFC 4145). Active is the
+// DTLS client, passive the DTLS server.
+type SetupRole string
+
+const (
+	SetupActive   SetupRole = "active"
+	SetupPassive  SetupRole = "passive"
+	SetupActpass  SetupRole = "actpass"
+	SetupHoldconn SetupRole = "holdconn"
+)
+
+var (
+	// ErrFingerprintMismatch is returned when the DTLS peer certificate does
+	// not match any fingerprint of its description.
+	ErrFingerprintMismatch = errors.New("DTLS certificate does not match the fingerprint")
+	// ErrNoSRTPProfile is returned when a DTLS handshake agreed no SRTP protection profile.
+	ErrNoSRTPProfile = errors.New("no SRTP protection profile agreed")
+)
+
+// fingerprintHashes are the hash functions of RFC 8122 that can be checked.
+var fingerprintHashes = map[string]crypto.Hash{
+	"sha-1":   crypto.SHA1,
+	"sha-224": crypto.SHA224,
+	"sha-256": crypto.SHA256,
+	"sha-384": crypto.SHA384,
+	"sha-512": crypto.SHA512,
+}
+
+// dtlsProfiles maps the SRTP protection profiles of RFC 5764 and RFC 7714
+// to the crypto suites of the same keys.
+var dtlsProfiles = map[dtls.SRTPProtectionProfile]string{
+	dtls.SRTP_AEAD_AES_128_GCM:       SuiteAEADAES128GCM,
+	dtls.SRTP_AES128_CM_HMAC_SHA1_80: SuiteAESCM128HMACSHA180,
+	dtls.SRTP_AES128_CM_HMAC_SHA1_32: SuiteAESCM128HMACSHA132,
+}
+
+// GenerateDTLSCertificate returns a self-signed ECDSA certificate, as used
+// by WebRTC endpoints.
+func GenerateDTLSCertificate() (tls.Certificate, error) {
+	cert, err := selfsign.GenerateSelfSigned()
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("generating DTLS certificate: %w", err)
+	}
+
+	return cert, nil
+}
+
+// LoadDTLSCertificate reads a PEM encoded certificate and its private key.
+func LoadDTLSCertificate(certFile, keyFile string) (tls.Certificate, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("loading DTLS certificate: %w", err)
+	}
+
+	return cert, nil
+}
+
+// Fingerprint is the value of an a=fingerprint attribute (RFC 8122).
+type Fingerprint struct {
+	Algorithm string // e.g. "sha-256"
+	Value     string // upper case hex bytes separated by colons
+}
+
+// NewFingerprint returns the sha-256 fingerprint of the leaf certificate.
+func NewFingerprint(cert tls.Certificate) (Fingerprint, error) {
+	if len(cert.Certificate) == 0 {
+		return Fingerprint{}, fmt.Errorf("no certificate to fingerprint")
+	}
+
+	return fingerprintOf(cert.Certificate[0], "sha-256")
+}
+
+func fingerprintOf(raw []byte, algorithm string) (Fingerprint, error) {
+	hash, ok := fingerprintHashes[strings.ToLower(algorithm)]
+	if !ok || !hash.Available() {
+		return Fingerprint{}, fmt.Errorf("unsupported fingerprint algorithm %s", algorithm)
+	}
+
+	h := hash.New()
+	h.Write(raw)
+
+	hexBytes := []string{}
+	for _, b := range h.Sum(nil) {
+		hexBytes = append(hexBytes, fmt.Sprintf("%02X", b))
+	}
+
+	return Fingerprint{Algorithm: strings.ToLower(algorithm), Value: strings.Join(hexBytes, ":")}, nil
+}
+
+// String formats the fingerprint as the value of an a=fingerprint attribute.
+func (f Fingerprint) String() string {
+	return f.Algorithm + " " + f.Value
+}
+
+// matches reports whether raw is the certificate the fingerprint is of.
+func (f Fingerprint) matches(raw []byte) bool {
+	actual, err := fingerprintOf(raw, f.Algorithm)
+
+	return err == nil && strings.EqualFold(actual.Value, f.Value)
+}
+
+// DTLSParameters are what a DTLS-SRTP handshake on a stream needs.
+type DTLSParameters struct {
+	Role               SetupRole // of the local side, active or passive
+	Certificate        tls.Certificate
+	RemoteFingerprints []Fingerprint
+}
+
+// parseFingerprints returns the fingerprints of the m= line, or of the
+// session if the m= line has none.
+func parseFingerprints(desc *sdp.SessionDescription, md *sdp.MediaDescription) []Fingerprint {
+	parse := func(attributes []sdp.Attribute) []Fingerprint {
+		fingerprints := []Fingerprint{}
+
+		for _, attr := range attributes {
+			if attr.Key != fingerprintHeader {
+				continue
+			}
+
+			algorithm, value, ok := strings.Cut(strings.TrimSpace(attr.Value), " ")
+			if ok {
+				fingerprints = append(fingerprints, Fingerprint{Algorithm: strings.ToLower(algorithm), Value: strings.TrimSpace(value)})
+			}
+		}
+
+		return fingerprints
+	}
+
+	if fingerprints := parse(md.Attributes); len(fingerprints) > 0 {
+		return fingerprints
+	}
+
+	return parse(desc.Attributes)
+}
+
+// parseSetup returns the a=setup role of the m= line or of the session. If
+// there is none, RFC 4145 section 4 has an offer default to active and an
+// answer to passive.
+func parseSetup(desc *sdp.SessionDescription, md *sdp.MediaDescription, isOffer bool) SetupRole {
+	if value, ok := md.Attribute(setupHeader); ok {
+		return SetupRole(strings.TrimSpace(value))
+	}
+
+	if value, ok := desc.Attribute(setupHeader); ok {
+		return SetupRole(strings.TrimSpace(value))
+	}
+
+	if isOffer {
+		return SetupActive
+	}
+
+	return SetupPassive
+}
+
+// answerSetup returns the local role answering the remote one, preferring
+// active as RFC 5763 section 5 recommends. It reports false when no
+// connection can be set up.
+func answerSetup(remote SetupRole) (SetupRole, bool) {
+	switch remote {
+	case SetupActpass, SetupPassive:
+		return SetupActive, true
+	case SetupActive:
+		return SetupPassive, true
+	}
+
+	return "", false
+}
+
+// answeredSetup returns the local role of an offerer given the answer. It
+// reports false when the answer picked no role, e.g. actpass or holdconn.
+func answeredSetup(answer SetupRole) (SetupRole, bool) {
+	switch answer {
+	case SetupPassive:
+		return SetupActive, true
+	case SetupActive:
+		return SetupPassive, true
+	}
+
+	return "", false
+}
+
+// dtlsAttributes are the fingerprint and setup role of a local m= line.
+func (cfg *config) dtlsAttributes(role SetupRole) []sdp.Attribute {
+	return []sdp.Attribute{
+		{Key: fingerprintHeader, Value: cfg.dtlsFingerprint.String()},
+		{Key: setupHeader, Value: string(role)},
+	}
+}
+
+// DTLSConn is the DTLS association of a stream after a DTLS-SRTP handshake.
+// It stays open until the stream closes, so that a final flight the peer did
+// not receive can be sent again when it retransmits its own.
+type DTLSConn struct {
+	conn  *dtls.Conn
+	demux *dtlsPacketConn
+	keys  *SRTPKeys
+}
+
+// DTLSHandshake runs a DTLS handshake with remote over conn, typically the
+// RTP connection of a stream, checks the peer certificate against the
+// remote fingerprints and exports the SRTP keys (RFC 5764 section 4.2).
+// Packets other than DTLS read meanwhile are dropped. Once it returns, the
+// caller reads conn again and must pass what it reads to DTLSConn.Handle.
+func DTLSHandshake(ctx context.Context, conn net.PacketConn, remote net.Addr, params DTLSParameters) (*DTLSConn, error) {
+	demux := newDTLSPacketConn(conn)
+
+	opts := []dtls.Option{
+		dtls.WithCertificates(params.Certificate),
+		dtls.WithSRTPProtectionProfiles(dtls.SRTP_AEAD_AES_128_GCM, dtls.SRTP_AES128_CM_HMAC_SHA1_80, dtls.SRTP_AES128_CM_HMAC_SHA1_32),
+		dtls.WithExtendedMasterSecret(dtls.RequireExtendedMasterSecret),
+		dtls.WithInsecureSkipVerify(true),
+		dtls.WithVerifyPeerCertificate(func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			return verifyFingerprints(rawCerts, params.RemoteFingerprints)
+		}),
+	}
+
+	var (
+		dtlsConn *dtls.Conn
+		err      error
+	)
+
+	switch params.Role {
+	case SetupActive:
+		clientOpts := []dtls.ClientOption{}
+		for _, opt := range opts {
+			clientOpts = append(clientOpts, opt)
+		}
+
+		dtlsConn, err = dtls.ClientWithOptions(demux, remote, clientOpts...)
+	case SetupPassive:
+		serverOpts := []dtls.ServerOption{dtls.WithClientAuth(dtls.RequireAnyClientCert)}
+		for _, opt := range opts {
+			serverOpts = append(serverOpts, opt)
+		}
+
+		dtlsConn, err = dtls.ServerWithOptions(demux, remote, serverOpts...)
+	default:
+		return nil, fmt.Errorf("cannot run a DTLS handshake with setup role %q", params.Role)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("creating DTLS connection: %w", err)
+	}
+
+	if err := dtlsConn.HandshakeContext(ctx); err != nil {
+		// The DTLS connection stopped reading the media connection already.
+		return nil, errors.Join(fmt.Errorf("DTLS handshake with %s: %w", remote, err), dtlsConn.Close())
+	}
+
+	demux.handOff()
+
+	result := &DTLSConn{conn: dtlsConn, demux: demux}
+
+	result.keys, err = exportSRTPKeys(dtlsConn, params.Role == SetupActive)
+	if err != nil {
+		return nil, errors.Join(err, result.Close())
+	}
+
+	return result, nil
+}
+
+// SRTPKeys returns the keys exported from the handshake.
+func (c *DTLSConn) SRTPKeys() *SRTPKeys {
+	return c.keys
+}
+
+// Handle passes packet, read from the media connection from addr, to the
+// DTLS association if it is a DTLS record, and reports whether it was one,
+// in which case the caller must not treat it as RTP or RTCP.
+func (c *DTLSConn) Handle(packet []byte, addr net.Addr) bool {
+	if !isDTLSPacket(packet) {
+		return false
+	}
+
+	c.demux.deliver(packet, addr)
+
+	return true
+}
+
+// Close sends close_notify to the peer and ends the association, leaving the
+// media connection open.
+func (c *DTLSConn) Close() error {
+	c.demux.handOff()
+
+	return c.conn.Close()
+}
+
+// exportSRTPKeys derives the keys of the agreed profile. The client keys
+// come first in the exported material, then the server keys, then the
+// client and server salts.
+func exportSRTPKeys(dtlsConn *dtls.Conn, isClient bool) (*SRTPKeys, error) {
+	profile, ok := dtlsConn.SelectedSRTPProtectionProfile()
+	if !ok {
+		return nil, ErrNoSRTPProfile
+	}
+
+	suite, ok := dtlsProfiles[profile]
+	if !ok {
+		return nil, fmt.Errorf("%w: DTLS profile %d", ErrUnsupportedSuite, profile)
+	}
+
+	state, ok := dtlsConn.ConnectionState()
+	if !ok {
+		return nil, fmt.Errorf("reading DTLS connection state")
+	}
+
+	lengths := srtpKeyLengths[suite]
+
+	material, err := state.ExportKeyingMaterial(dtlsSRTPLabel, nil, 2*(lengths.key+lengths.salt))
+	if err != nil {
+		return nil, fmt.Errorf("exporting SRTP keying material: %w", err)
+	}
+
+	clientKey := material[:lengths.key]
+	serverKey := material[lengths.key : 2*lengths.key]
+	clientSalt := material[2*lengths.key : 2*lengths.key+lengths.salt]
+	serverSalt := material[2*lengths.key+lengths.salt:]
+
+	keys := &SRTPKeys{
+		Suite:            suite,
+		LocalMasterKey:   serverKey,
+		LocalMasterSalt:  serverSalt,
+		RemoteMasterKey:  clientKey,
+		RemoteMasterSalt: clientSalt,
+	}
+
+	if isClient {
+		keys.LocalMasterKey, keys.RemoteMasterKey = keys.RemoteMasterKey, keys.LocalMasterKey
+		keys.LocalMasterSalt, keys.RemoteMasterSalt = keys.RemoteMasterSalt, keys.LocalMasterSalt
+	}
+
+	return keys, nil
+}
+
+func verifyFingerprints(rawCerts [][]byte, fingerprints []Fingerprint) error {
+	if len(rawCerts) == 0 {
+		return fmt.Errorf("%w: no certificate", ErrFingerprintMismatch)
+	}
+
+	for _, fingerprint := range fingerprints {
+		if fingerprint.matches(rawCerts[0]) {
+			return nil
+		}
+	}
+
+	return ErrFingerprintMismatch
+}
+
+// isDTLSPacket tells DTLS records apart from STUN, RTP and RTCP as
+// described in RFC 7983 section 7.
+func isDTLSPacket(packet []byte) bool {
+	return len(packet) > 0 && packet[0] >= 20 && packet[0] <= 63
+}
+
+// dtlsPacketConn gives a DTLS connection the DTLS records arriving on a
+// media connection. During the handshake it reads them from the media
+// connection itself; once handed off, the media reader owns the connection
+// and the records come from deliver.
+type dtlsPacketConn struct {
+	net.PacketConn
+
+	handedOff atomic.Bool
+	left      chan struct{} // closed once ReadFrom stopped reading the media connection
+	leftOnce  sync.Once
+	packets   chan dtlsPacket
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+type dtlsPacket struct {
+	data []byte
+	addr net.Addr
+}
+
+func newDTLSPacketConn(conn net.PacketConn) *dtlsPacketConn {
+	return &dtlsPacketConn{
+		PacketConn: conn,
+		left:       make(chan struct{}),
+		packets:    make(chan dtlsPacket, dtlsPacketBuffer),
+		closed:     make(chan struct{}),
+	}
+}
+
+func (c *dtlsPacketConn) ReadFrom(p []byte) (int, net.Addr, error) {
+	for !c.handedOff.Load() {
+		n, addr, err := c.PacketConn.ReadFrom(p)
+		switch {
+		case err != nil && c.handedOff.Load():
+		case err != nil:
+			return n, addr, err
+		case isDTLSPacket(p[:n]):
+			return n, addr, nil
+		}
+	}
+
+	c.leftOnce.Do(func() {
+		close(c.left)
+	})
+
+	select {
+	case packet := <-c.packets:
+		return copy(p, packet.data), packet.addr, nil
+	case <-c.closed:
+		return 0, nil, net.ErrClosed
+	}
+}
+
+// deliver queues a record read by the media reader, dropping it if the
+// DTLS connection is not keeping up, as the network could have.
+func (c *dtlsPacketConn) deliver(packet []byte, addr net.Addr) {
+	select {
+	case c.packets <- dtlsPacket{data: slices.Clone(packet), addr: addr}:
+	case <-c.closed:
+	default:
+	}
+}
+
+// SetDeadline, SetReadDeadline and SetWriteDeadline only apply during the
+// handshake; afterwards the deadlines of the media connection belong to the
+// media reader.
+func (c *dtlsPacketConn) SetDeadline(t time.Time) error {
+	if c.handedOff.Load() {
+		return nil
+	}
+
+	return c.PacketConn.SetDeadline(t)
+}
+
+func (c *dtlsPacketConn) SetReadDeadline(t time.Time) error {
+	if c.handedOff.Load() {
+		return nil
+	}
+
+	return c.PacketConn.SetReadDeadline(t)
+}
+
+func (c *dtlsPacketConn) SetWriteDeadline(t time.Time) error {
+	if c.handedOff.Load() {
+		return nil
+	}
+
+	return c.PacketConn.SetWriteDeadline(t)
+}
+
+// Close leaves the media connection open.
+func (c *dtlsPacketConn) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.closed)
+	})
+
+	return nil
+}
+
+// handOff makes the DTLS connection stop reading the media connection and
+// waits until a pending read of it is interrupted.
+func (c *dtlsPacketConn) handOff() {
+	if c.handedOff.Swap(true) {
+		return
+	}
+
+	defer c.PacketConn.SetReadDeadline(time.Time{})
+
+	for range dtlsHandOffAttempts {
+		c.PacketConn.SetReadDeadline(time.Now())
+
+		select {
+		case <-c.left:
+			return
+		case <-time.After(time.Millisecond):
+		}
+	}
+}
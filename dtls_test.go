@@ -0,0 +1,193 @@
+package sdp
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/pion/sdp/v4"
+)
+
+func TestDTLSHandshake(t *testing.T) {
+	listen := func() *net.UDPConn {
+		conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+		if err != nil {
+			t.Fatalf("listening: %v", err)
+		}
+
+		t.Cleanup(func() { conn.Close() })
+
+		return conn
+	}
+
+	newParams := func(role SetupRole) DTLSParameters {
+		cert, err := GenerateDTLSCertificate()
+		if err != nil {
+			t.Fatalf("GenerateDTLSCertificate: %v", err)
+		}
+
+		return DTLSParameters{Role: role, Certificate: cert}
+	}
+
+	connActive, connPassive := listen(), listen()
+	active, passive := newParams(SetupActive), newParams(SetupPassive)
+
+	activeFingerprint, err := NewFingerprint(active.Certificate)
+	if err != nil {
+		t.Fatalf("NewFingerprint: %v", err)
+	}
+
+	passiveFingerprint, err := NewFingerprint(passive.Certificate)
+	if err != nil {
+		t.Fatalf("NewFingerprint: %v", err)
+	}
+
+	active.RemoteFingerprints = []Fingerprint{passiveFingerprint}
+	passive.RemoteFingerprints = []Fingerprint{activeFingerprint}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	type outcome struct {
+		conn *DTLSConn
+		err  error
+	}
+
+	passiveDone := make(chan outcome, 1)
+	go func() {
+		conn, err := DTLSHandshake(ctx, connPassive, connActive.LocalAddr(), passive)
+		passiveDone <- outcome{conn, err}
+	}()
+
+	activeConn, err := DTLSHandshake(ctx, connActive, connPassive.LocalAddr(), active)
+	if err != nil {
+		t.Fatalf("active DTLSHandshake: %v", err)
+	}
+	defer activeConn.Close()
+
+	result := <-passiveDone
+	if result.err != nil {
+		t.Fatalf("passive DTLSHandshake: %v", result.err)
+	}
+
+	passiveConn := result.conn
+	defer passiveConn.Close()
+
+	activeKeys, passiveKeys := activeConn.SRTPKeys(), passiveConn.SRTPKeys()
+	if activeKeys.Suite != passiveKeys.Suite {
+		t.Fatalf("suites differ: %s and %s", activeKeys.Suite, passiveKeys.Suite)
+	}
+
+	if !bytes.Equal(activeKeys.LocalMasterKey, passiveKeys.RemoteMasterKey) ||
+		!bytes.Equal(activeKeys.LocalMasterSalt, passiveKeys.RemoteMasterSalt) ||
+		!bytes.Equal(activeKeys.RemoteMasterKey, passiveKeys.LocalMasterKey) ||
+		!bytes.Equal(activeKeys.RemoteMasterSalt, passiveKeys.LocalMasterSalt) {
+		t.Fatal("exported keys do not match")
+	}
+
+	if bytes.Equal(activeKeys.LocalMasterKey, activeKeys.RemoteMasterKey) {
+		t.Fatal("both directions use the same key")
+	}
+
+	// The media connections belong to the caller again.
+	rtp := []byte{0x80, 0x00, 0x00, 0x01}
+	if _, err := connActive.WriteTo(rtp, connPassive.LocalAddr()); err != nil {
+		t.Fatalf("sending RTP: %v", err)
+	}
+
+	connPassive.SetReadDeadline(time.Now().Add(time.Second))
+
+	buf := make([]byte, 1500)
+
+	n, _, err := connPassive.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("reading RTP after the handshake: %v", err)
+	}
+
+	if !bytes.Equal(buf[:n], rtp) || passiveConn.Handle(buf[:n], connActive.LocalAddr()) {
+		t.Fatalf("read %x, want the RTP packet %x", buf[:n], rtp)
+	}
+}
+
+func TestDTLSHandshakeFingerprintMismatch(t *testing.T) {
+	connActive, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("listening: %v", err)
+	}
+	defer connActive.Close()
+
+	connPassive, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("listening: %v", err)
+	}
+	defer connPassive.Close()
+
+	certActive, _ := GenerateDTLSCertificate()
+	certPassive, _ := GenerateDTLSCertificate()
+	wrong := Fingerprint{Algorithm: "sha-256", Value: "00"}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	go DTLSHandshake(ctx, connPassive, connActive.LocalAddr(), DTLSParameters{
+		Role:               SetupPassive,
+		Certificate:        certPassive,
+		RemoteFingerprints: []Fingerprint{wrong},
+	})
+
+	_, err = DTLSHandshake(ctx, connActive, connPassive.LocalAddr(), DTLSParameters{
+		Role:               SetupActive,
+		Certificate:        certActive,
+		RemoteFingerprints: []Fingerprint{wrong},
+	})
+	if err == nil {
+		t.Fatal("handshake succeeded with a wrong fingerprint")
+	}
+}
+
+func TestParseSetup(t *testing.T) {
+	withSetup := func(role string) *sdp.MediaDescription {
+		md := &sdp.MediaDescription{}
+		if role != "" {
+			md.Attributes = []sdp.Attribute{{Key: setupHeader, Value: role}}
+		}
+
+		return md
+	}
+
+	tests := []struct {
+		name      string
+		setup     string
+		isOffer   bool
+		want      SetupRole
+		answered  SetupRole
+		answerErr bool
+	}{
+		{name: "offer without setup", isOffer: true, want: SetupActive},
+		{name: "answer without setup", want: SetupPassive, answered: SetupActive},
+		{name: "active answer", setup: "active", want: SetupActive, answered: SetupPassive},
+		{name: "passive answer", setup: "passive", want: SetupPassive, answered: SetupActive},
+		{name: "actpass answer", setup: "actpass", want: SetupActpass, answerErr: true},
+		{name: "holdconn answer", setup: "holdconn", want: SetupHoldconn, answerErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseSetup(&sdp.SessionDescription{}, withSetup(tt.setup), tt.isOffer)
+			if got != tt.want {
+				t.Fatalf("parseSetup() = %s, want %s", got, tt.want)
+			}
+
+			if tt.isOffer {
+				return
+			}
+
+			role, ok := answeredSetup(got)
+			if ok == tt.answerErr || role != tt.answered {
+				t.Fatalf("answeredSetup(%s) = %s, %v, want %s", got, role, ok, tt.answered)
+			}
+		})
+	}
+}
@@ -0,0 +1,235 @@
+package sdp
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	telephoneEvent       = "telephone-event"
+	telephoneEventEvents = "0-16"
+	defaultEvents        = "0-15" // assumed without a=fmtp, RFC 4733 section 2.4.1
+	rtpVersion           = 2
+	rtpHeaderSize        = 12
+	dtmfPayloadSize      = 4
+)
+
+// ErrShortPacket is returned when a packet is too short to hold what its header announces.
+var ErrShortPacket = errors.New("packet too short")
+
+func isTelephoneEvent(codec Codec) bool {
+	return strings.EqualFold(codec.Name, telephoneEvent)
+}
+
+// selectTelephoneEvent keeps the first telephone-event codec with the clock
+// rate of the selected media codec, as required by RFC 4733 section 7.1.1.
+func selectTelephoneEvent(codecs []Codec) []Codec {
+	selected := []Codec{}
+	clockRate := 0
+
+	for _, codec := range codecs {
+		if !isTelephoneEvent(codec) {
+			if clockRate == 0 {
+				clockRate = codec.ClockRate
+			}
+
+			selected = append(selected, codec)
+		}
+	}
+
+	for _, codec := range codecs {
+		if isTelephoneEvent(codec) && codec.ClockRate == clockRate {
+			selected = append(selected, codec)
+
+			break
+		}
+	}
+
+	return selected
+}
+
+// intersectEvents returns the events, like "0-15,66", present in both lists.
+func intersectEvents(local, remote string) string {
+	localEvents := parseEvents(local)
+	events := []int{}
+
+	for _, event := range parseEvents(remote) {
+		if slices.Contains(localEvents, event) {
+			events = append(events, event)
+		}
+	}
+
+	ranges := []string{}
+	for i := 0; i < len(events); {
+		j := i
+		for j+1 < len(events) && events[j+1] == events[j]+1 {
+			j++
+		}
+
+		if i == j {
+			ranges = append(ranges, strconv.Itoa(events[i]))
+		} else {
+			ranges = append(ranges, fmt.Sprintf("%d-%d", events[i], events[j]))
+		}
+
+		i = j + 1
+	}
+
+	return strings.Join(ranges, ",")
+}
+
+func parseEvents(list string) []int {
+	events := []int{}
+
+	for _, item := range strings.Split(list, ",") {
+		first, last, isRange := strings.Cut(strings.TrimSpace(item), "-")
+
+		from, err := strconv.Atoi(first)
+		if err != nil {
+			continue
+		}
+
+		to := from
+		if isRange {
+			if to, err = strconv.Atoi(last); err != nil {
+				continue
+			}
+		}
+
+		for event := from; event <= to && event <= 255; event++ {
+			if !slices.Contains(events, event) {
+				events = append(events, event)
+			}
+		}
+	}
+
+	slices.Sort(events)
+
+	return events
+}
+
+// DTMFEvent returns the RFC 4733 event code of a DTMF digit: 0-9, *, #, A-D.
+func DTMFEvent(digit rune) (uint8, error) {
+	switch {
+	case digit >= '0' && digit <= '9':
+		return uint8(digit - '0'), nil
+	case digit == '*':
+		return 10, nil
+	case digit == '#':
+		return 11, nil
+	case digit >= 'A' && digit <= 'D':
+		return uint8(digit-'A') + 12, nil
+	case digit >= 'a' && digit <= 'd':
+		return uint8(digit-'a') + 12, nil
+	}
+
+	return 0, fmt.Errorf("%q is not a DTMF digit", digit)
+}
+
+// DTMFDigit returns the DTMF digit of an RFC 4733 event code.
+func DTMFDigit(event uint8) (rune, bool) {
+	const digits = "0123456789*#ABCD"
+	if int(event) >= len(digits) {
+		return 0, false
+	}
+
+	return rune(digits[event]), true
+}
+
+// DTMFPacket is an RTP packet carrying an RFC 4733 named telephone event.
+// The marker is set on the first packet of an event; the packet with End set
+// is usually sent three times with the same timestamp and duration.
+type DTMFPacket struct {
+	PayloadType    uint8
+	Marker         bool
+	SequenceNumber uint16
+	Timestamp      uint32
+	SSRC           uint32
+
+	Event    uint8
+	End      bool
+	Volume   uint8 // in -dBm0, 0-63
+	Duration uint16
+}
+
+// Marshal encodes the packet with a minimal RTP header.
+func (p DTMFPacket) Marshal() []byte {
+	data := make([]byte, rtpHeaderSize+dtmfPayloadSize)
+
+	data[0] = rtpVersion << 6
+	data[1] = p.PayloadType & 0x7f
+	if p.Marker {
+		data[1] |= 0x80
+	}
+
+	binary.BigEndian.PutUint16(data[2:], p.SequenceNumber)
+	binary.BigEndian.PutUint32(data[4:], p.Timestamp)
+	binary.BigEndian.PutUint32(data[8:], p.SSRC)
+
+	data[12] = p.Event
+	data[13] = p.Volume & 0x3f
+	if p.End {
+		data[13] |= 0x80
+	}
+
+	binary.BigEndian.PutUint16(data[14:], p.Duration)
+
+	return data
+}
+
+// Unmarshal decodes an RTP packet, skipping CSRCs, header extension and
+// padding, and reads its payload as a telephone event.
+func (p *DTMFPacket) Unmarshal(data []byte) error {
+	if len(data) < rtpHeaderSize {
+		return fmt.Errorf("RTP header of %d bytes: %w", len(data), ErrShortPacket)
+	}
+
+	if version := data[0] >> 6; version != rtpVersion {
+		return fmt.Errorf("unsupported RTP version %d", version)
+	}
+
+	end := len(data)
+	if data[0]&0x20 != 0 {
+		end -= int(data[end-1])
+	}
+
+	offset := rtpHeaderSize + 4*int(data[0]&0x0f)
+	if data[0]&0x10 != 0 {
+		if end < offset+4 {
+			return fmt.Errorf("RTP header extension: %w", ErrShortPacket)
+		}
+
+		offset += 4 + 4*int(binary.BigEndian.Uint16(data[offset+2:]))
+	}
+
+	if end < offset+dtmfPayloadSize {
+		return fmt.Errorf("telephone event payload: %w", ErrShortPacket)
+	}
+
+	p.Marker = data[1]&0x80 != 0
+	p.PayloadType = data[1] & 0x7f
+	p.SequenceNumber = binary.BigEndian.Uint16(data[2:])
+	p.Timestamp = binary.BigEndian.Uint32(data[4:])
+	p.SSRC = binary.BigEndian.Uint32(data[8:])
+
+	p.Event = data[offset]
+	p.End = data[offset+1]&0x80 != 0
+	p.Volume = data[offset+1] & 0x3f
+	p.Duration = binary.BigEndian.Uint16(data[offset+2:])
+
+	return nil
+}
+
+// WriteDTMFPacket sends the packet through the RTP connection.
+func WriteDTMFPacket(connRTP net.PacketConn, addr net.Addr, packet DTMFPacket) error {
+	if _, err := connRTP.WriteTo(packet.Marshal(), addr); err != nil {
+		return fmt.Errorf("failed to send telephone event %d: %w", packet.Event, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,103 @@
+package sdp
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestIntersectEvents(t *testing.T) {
+	tests := []struct {
+		local, remote string
+		want          string
+	}{
+		{local: "0-15", remote: "0-15", want: "0-15"},
+		{local: "0-16", remote: "0-15,66", want: "0-15"},
+		{local: "0-15,66,70", remote: "66,70,3", want: "3,66,70"},
+		{local: "0-15", remote: "12-20", want: "12-15"},
+		{local: "0-15", remote: "66", want: ""},
+		{local: "0-15", remote: "x,5-y,7", want: "7"},
+		{local: "250-300", remote: "0-255", want: "250-255"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.local+" and "+tt.remote, func(t *testing.T) {
+			if got := intersectEvents(tt.local, tt.remote); got != tt.want {
+				t.Fatalf("intersectEvents(%q, %q) = %q, want %q", tt.local, tt.remote, got, tt.want)
+			}
+		})
+	}
+
+	if got := parseEvents("3, 1-2,2"); !slices.Equal(got, []int{1, 2, 3}) {
+		t.Fatalf("parseEvents() = %v, want sorted events without duplicates", got)
+	}
+}
+
+func TestDTMFPacket(t *testing.T) {
+	packet := DTMFPacket{
+		PayloadType:    101,
+		Marker:         true,
+		SequenceNumber: 4242,
+		Timestamp:      160000,
+		SSRC:           0xdeadbeef,
+		Event:          11,
+		End:            true,
+		Volume:         10,
+		Duration:       800,
+	}
+
+	data := packet.Marshal()
+
+	withCSRC := append([]byte{data[0] | 1}, data[1:rtpHeaderSize]...)
+	withCSRC = append(withCSRC, 0, 0, 0, 1)
+	withCSRC = append(withCSRC, data[rtpHeaderSize:]...)
+
+	withExtension := append([]byte{data[0] | 0x10}, data[1:rtpHeaderSize]...)
+	withExtension = append(withExtension, 0xbe, 0xde, 0, 1, 1, 2, 3, 4)
+	withExtension = append(withExtension, data[rtpHeaderSize:]...)
+
+	withPadding := append([]byte{data[0] | 0x20}, data[1:]...)
+	withPadding = append(withPadding, 0, 0, 0, 4)
+
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr error
+	}{
+		{name: "marshaled", data: data},
+		{name: "with CSRC", data: withCSRC},
+		{name: "with header extension", data: withExtension},
+		{name: "with padding", data: withPadding},
+		{name: "short header", data: data[:rtpHeaderSize-1], wantErr: ErrShortPacket},
+		{name: "short payload", data: data[:rtpHeaderSize+2], wantErr: ErrShortPacket},
+		{name: "short extension", data: withExtension[:rtpHeaderSize+2], wantErr: ErrShortPacket},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got DTMFPacket
+
+			err := got.Unmarshal(tt.data)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Unmarshal() error = %v, want %v", err, tt.wantErr)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Unmarshal: %v", err)
+			}
+
+			if got != packet {
+				t.Fatalf("Unmarshal() = %+v, want %+v", got, packet)
+			}
+		})
+	}
+
+	var got DTMFPacket
+	if err := got.Unmarshal(append([]byte{0}, data[1:]...)); err == nil {
+		t.Fatal("Unmarshal accepted RTP version 0")
+	}
+}
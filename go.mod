@@ -6,14 +6,21 @@ require (
 	github.com/emiago/sipgo v1.0.1
 	github.com/google/uuid v1.6.0
 	github.com/icholy/digest v1.1.0
+	github.com/pion/dtls/v3 v3.1.10
 	github.com/pion/sdp/v4 v4.0.0-20240223200530-fb77fb3c6578
+	github.com/pion/stun/v3 v3.1.7
 )
 
 require (
 	github.com/gobwas/httphead v0.1.0 // indirect
 	github.com/gobwas/pool v0.2.1 // indirect
 	github.com/gobwas/ws v1.4.0 // indirect
+	github.com/pion/logging v0.2.4 // indirect
 	github.com/pion/randutil v0.1.0 // indirect
+	github.com/pion/transport/v4 v4.1.0 // indirect
+	github.com/pion/transport/v5 v5.0.0 // indirect
+	github.com/wlynxg/anet v0.0.5 // indirect
+	golang.org/x/crypto v0.48.0 // indirect
 	golang.org/x/sync v0.19.0 // indirect
-	golang.org/x/sys v0.39.0 // indirect
+	golang.org/x/sys v0.41.0 // indirect
 )
@@ -0,0 +1,373 @@
+package sdp
+
+import (
+	"crypto/rand"
+	"fmt"
+	"hash/crc32"
+	"math/big"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pion/sdp/v4"
+	"github.com/pion/stun/v3"
+)
+
+const (
+	iceLiteHeader   = "ice-lite"
+	iceUfragHeader  = "ice-ufrag"
+	icePwdHeader    = "ice-pwd"
+	candidateHeader = "candidate"
+	iceChars        = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/"
+	iceUfragLength  = 8
+	icePwdLength    = 24
+
+	CandidateHost            = "host"
+	CandidateServerReflexive = "srflx"
+	CandidatePeerReflexive   = "prflx"
+	CandidateRelay           = "relay"
+
+	ComponentRTP  = 1
+	ComponentRTCP = 2
+)
+
+// typePreferences are the recommended values of RFC 8445 section 5.1.2.2.
+var typePreferences = map[string]uint32{
+	CandidateHost:            126,
+	CandidatePeerReflexive:   110,
+	CandidateServerReflexive: 100,
+	CandidateRelay:           0,
+}
+
+// ICECredentials are the ice-ufrag and ice-pwd of one side of a session.
+type ICECredentials struct {
+	Ufrag string
+	Pwd   string
+}
+
+// NewICECredentials returns random credentials, long enough for RFC 8839.
+func NewICECredentials() (ICECredentials, error) {
+	ufrag, err := randomICEString(iceUfragLength)
+	if err != nil {
+		return ICECredentials{}, fmt.Errorf("generating ice-ufrag: %w", err)
+	}
+
+	pwd, err := randomICEString(icePwdLength)
+	if err != nil {
+		return ICECredentials{}, fmt.Errorf("generating ice-pwd: %w", err)
+	}
+
+	return ICECredentials{Ufrag: ufrag, Pwd: pwd}, nil
+}
+
+// randomICEString returns length characters drawn uniformly from iceChars.
+func randomICEString(length int) (string, error) {
+	buf := make([]byte, length)
+	chars := big.NewInt(int64(len(iceChars)))
+
+	for i := range buf {
+		n, err := rand.Int(rand.Reader, chars)
+		if err != nil {
+			return "", err
+		}
+
+		buf[i] = iceChars[n.Int64()]
+	}
+
+	return string(buf), nil
+}
+
+// ICECandidate is an a=candidate line as defined in RFC 8839 section 5.1.
+type ICECandidate struct {
+	Foundation     string
+	Component      int
+	Transport      string
+	Priority       uint32
+	Address        string // an IP address or an FQDN
+	Port           int
+	Type           string
+	RelatedAddress string // "" if none
+	RelatedPort    int
+}
+
+// Addr returns the address of the candidate, nil if it is not an IP.
+func (c ICECandidate) Addr() *net.UDPAddr {
+	ip := net.ParseIP(c.Address)
+	if ip == nil {
+		return nil
+	}
+
+	return &net.UDPAddr{IP: ip, Port: c.Port}
+}
+
+// String formats the candidate as the value of an a=candidate attribute.
+func (c ICECandidate) String() string {
+	value := fmt.Sprintf("%s %d %s %d %s %d typ %s", c.Foundation, c.Component, c.Transport, c.Priority, c.Address, c.Port, c.Type)
+	if c.RelatedAddress != "" {
+		value += fmt.Sprintf(" raddr %s rport %d", c.RelatedAddress, c.RelatedPort)
+	}
+
+	return value
+}
+
+// ParseICECandidate reads the value of an a=candidate attribute, ignoring
+// unknown extensions.
+func ParseICECandidate(value string) (ICECandidate, error) {
+	fields := strings.Fields(strings.TrimPrefix(value, candidateHeader+":"))
+	if len(fields) < 8 || fields[6] != "typ" {
+		return ICECandidate{}, fmt.Errorf("malformed candidate %q", value)
+	}
+
+	component, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return ICECandidate{}, fmt.Errorf("parsing component of candidate %q: %w", value, err)
+	}
+
+	priority, err := strconv.ParseUint(fields[3], 10, 32)
+	if err != nil {
+		return ICECandidate{}, fmt.Errorf("parsing priority of candidate %q: %w", value, err)
+	}
+
+	port, err := strconv.Atoi(fields[5])
+	if err != nil {
+		return ICECandidate{}, fmt.Errorf("parsing port of candidate %q: %w", value, err)
+	}
+
+	candidate := ICECandidate{
+		Foundation: fields[0],
+		Component:  component,
+		Transport:  strings.ToUpper(fields[2]),
+		Priority:   uint32(priority),
+		Address:    fields[4],
+		Port:       port,
+		Type:       fields[7],
+	}
+
+	for i := 8; i+1 < len(fields); i += 2 {
+		switch fields[i] {
+		case "raddr":
+			candidate.RelatedAddress = fields[i+1]
+		case "rport":
+			candidate.RelatedPort, _ = strconv.Atoi(fields[i+1])
+		}
+	}
+
+	return candidate, nil
+}
+
+// newCandidate returns a UDP candidate with the priority of RFC 8445 section
+// 5.1.2.1 and a foundation shared by the candidates of the same type and base.
+func newCandidate(candidateType string, component int, addr, base *net.UDPAddr) ICECandidate {
+	candidate := ICECandidate{
+		Foundation: strconv.FormatUint(uint64(crc32.ChecksumIEEE([]byte(candidateType+base.IP.String()))), 10),
+		Component:  component,
+		Transport:  "UDP",
+		Priority:   typePreferences[candidateType]<<24 | 65535<<8 | uint32(256-component),
+		Address:    addr.IP.String(),
+		Port:       addr.Port,
+		Type:       candidateType,
+	}
+
+	if candidateType != CandidateHost {
+		candidate.RelatedAddress = base.IP.String()
+		candidate.RelatedPort = base.Port
+	}
+
+	return candidate
+}
+
+// gatherCandidates returns the host candidate of conn and, when it is
+// advertised with another address, a server reflexive one.
+func (cfg *config) gatherCandidates(conn UDPConn, component int) []ICECandidate {
+	base := conn.LocalAddr().(*net.UDPAddr)
+	candidates := []ICECandidate{newCandidate(CandidateHost, component, base, base)}
+
+	if advertised := cfg.advertisedAddr(base); !advertised.IP.Equal(base.IP) || advertised.Port != base.Port {
+		candidates = append(candidates, newCandidate(CandidateServerReflexive, component, advertised, base))
+	}
+
+	return candidates
+}
+
+// iceAttributes are the credentials and candidates of a local m= line.
+func (cfg *config) iceAttributes(stream negotiatedStream) []sdp.Attribute {
+	attributes := []sdp.Attribute{
+		{Key: iceUfragHeader, Value: cfg.ice.Ufrag},
+		{Key: icePwdHeader, Value: cfg.ice.Pwd},
+	}
+
+	candidates := cfg.gatherCandidates(stream.connRTP, ComponentRTP)
+	if stream.connRTCP != nil {
+		candidates = append(candidates, cfg.gatherCandidates(stream.connRTCP, ComponentRTCP)...)
+	}
+
+	for _, candidate := range candidates {
+		attributes = append(attributes, sdp.Attribute{Key: candidateHeader, Value: candidate.String()})
+	}
+
+	return attributes
+}
+
+// hasICE reports whether the remote description gives ICE credentials for
+// the m= line.
+func hasICE(desc *sdp.SessionDescription, md *sdp.MediaDescription) bool {
+	return parseICECredentials(desc, md) != nil
+}
+
+// parseICECredentials returns the credentials of the m= line, which
+// override the session level ones, or nil if there are none.
+func parseICECredentials(desc *sdp.SessionDescription, md *sdp.MediaDescription) *ICECredentials {
+	ufrag, okUfrag := md.Attribute(iceUfragHeader)
+	if !okUfrag {
+		ufrag, okUfrag = desc.Attribute(iceUfragHeader)
+	}
+
+	pwd, okPwd := md.Attribute(icePwdHeader)
+	if !okPwd {
+		pwd, okPwd = desc.Attribute(icePwdHeader)
+	}
+
+	if !okUfrag || !okPwd {
+		return nil
+	}
+
+	return &ICECredentials{Ufrag: ufrag, Pwd: pwd}
+}
+
+// parseICECandidates returns the well-formed candidates of the m= line.
+func parseICECandidates(md *sdp.MediaDescription) []ICECandidate {
+	candidates := []ICECandidate{}
+
+	for _, attr := range md.Attributes {
+		if attr.Key != candidateHeader {
+			continue
+		}
+
+		if candidate, err := ParseICECandidate(attr.Value); err == nil {
+			candidates = append(candidates, candidate)
+		}
+	}
+
+	return candidates
+}
+
+// ICELite answers the connectivity checks a full ICE agent sends to a local
+// connection, as described in RFC 8445 section 7.3. Being lite, it is always
+// controlled and never sends checks itself.
+type ICELite struct {
+	local  ICECredentials
+	remote *ICECredentials
+
+	mu       sync.Mutex
+	selected *net.UDPAddr
+}
+
+// NewICELite returns an agent checking requests against the local
+// credentials and, if not nil, the remote ufrag.
+func NewICELite(local ICECredentials, remote *ICECredentials) *ICELite {
+	return &ICELite{
+		local:  local,
+		remote: remote,
+	}
+}
+
+// Handle answers packet if it is a STUN binding request sent to conn from
+// addr, and reports whether it was STUN at all, in which case the caller
+// must not treat it as RTP or RTCP. Messages that cannot be decoded or fail
+// the fingerprint check are silently discarded, as RFC 8445 section 7.3
+// asks.
+func (l *ICELite) Handle(conn net.PacketConn, packet []byte, addr net.Addr) (bool, error) {
+	if !stun.IsMessage(packet) {
+		return false, nil
+	}
+
+	req := &stun.Message{Raw: append([]byte{}, packet...)}
+	if err := req.Decode(); err != nil {
+		return true, nil
+	}
+
+	if req.Type != stun.BindingRequest || stun.Fingerprint.Check(req) != nil {
+		return true, nil
+	}
+
+	udpAddr, ok := addr.(*net.UDPAddr)
+	if !ok {
+		return true, fmt.Errorf("connectivity check from non-UDP address %s", addr)
+	}
+
+	if code, err := l.check(req); err != nil {
+		resp, errBuild := stun.Build(
+			stun.NewTransactionIDSetter(req.TransactionID),
+			stun.BindingError,
+			code,
+			stun.Fingerprint,
+		)
+		if errBuild != nil {
+			return true, fmt.Errorf("building STUN error response: %w", errBuild)
+		}
+
+		if _, errWrite := conn.WriteTo(resp.Raw, addr); errWrite != nil {
+			return true, fmt.Errorf("sending STUN error response to %s: %w", addr, errWrite)
+		}
+
+		return true, err
+	}
+
+	resp, err := stun.Build(
+		stun.NewTransactionIDSetter(req.TransactionID),
+		stun.BindingSuccess,
+		&stun.XORMappedAddress{IP: udpAddr.IP, Port: udpAddr.Port},
+		stun.NewShortTermIntegrity(l.local.Pwd),
+		stun.Fingerprint,
+	)
+	if err != nil {
+		return true, fmt.Errorf("building STUN binding response: %w", err)
+	}
+
+	if _, err := conn.WriteTo(resp.Raw, addr); err != nil {
+		return true, fmt.Errorf("sending STUN binding response to %s: %w", addr, err)
+	}
+
+	if req.Contains(stun.AttrUseCandidate) {
+		l.mu.Lock()
+		l.selected = udpAddr
+		l.mu.Unlock()
+	}
+
+	return true, nil
+}
+
+// check verifies the username and integrity of a request and returns the
+// error code to answer with when they are missing (400) or wrong (401), as
+// described in RFC 5389 section 10.1.2.
+func (l *ICELite) check(req *stun.Message) (stun.ErrorCode, error) {
+	var username stun.Username
+	if err := username.GetFrom(req); err != nil {
+		return stun.CodeBadRequest, fmt.Errorf("reading STUN username: %w", err)
+	}
+
+	if !req.Contains(stun.AttrMessageIntegrity) {
+		return stun.CodeBadRequest, fmt.Errorf("STUN request without message integrity")
+	}
+
+	localUfrag, remoteUfrag, _ := strings.Cut(username.String(), ":")
+	if localUfrag != l.local.Ufrag || (l.remote != nil && remoteUfrag != l.remote.Ufrag) {
+		return stun.CodeUnauthorized, fmt.Errorf("unexpected STUN username %q", username)
+	}
+
+	if err := stun.NewShortTermIntegrity(l.local.Pwd).Check(req); err != nil {
+		return stun.CodeUnauthorized, fmt.Errorf("checking STUN message integrity: %w", err)
+	}
+
+	return 0, nil
+}
+
+// Selected returns the remote address nominated with USE-CANDIDATE, to which
+// media should be sent, or nil while there is none.
+func (l *ICELite) Selected() *net.UDPAddr {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.selected
+}
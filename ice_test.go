@@ -0,0 +1,181 @@
+package sdp
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/pion/stun/v3"
+)
+
+func TestICELiteHandle(t *testing.T) {
+	local, err := NewICECredentials()
+	if err != nil {
+		t.Fatalf("NewICECredentials: %v", err)
+	}
+
+	remote, err := NewICECredentials()
+	if err != nil {
+		t.Fatalf("NewICECredentials: %v", err)
+	}
+
+	username := stun.NewUsername(local.Ufrag + ":" + remote.Ufrag)
+
+	tests := []struct {
+		name     string
+		setters  []stun.Setter
+		corrupt  bool
+		wantCode stun.ErrorCode // 0 for success, -1 for no answer
+		selected bool
+	}{
+		{
+			name:    "valid check",
+			setters: []stun.Setter{username, stun.NewShortTermIntegrity(local.Pwd), stun.Fingerprint},
+		},
+		{
+			name:     "nominated",
+			setters:  []stun.Setter{username, stun.RawAttribute{Type: stun.AttrUseCandidate}, stun.NewShortTermIntegrity(local.Pwd), stun.Fingerprint},
+			selected: true,
+		},
+		{
+			name:     "without username",
+			setters:  []stun.Setter{stun.NewShortTermIntegrity(local.Pwd), stun.Fingerprint},
+			wantCode: stun.CodeBadRequest,
+		},
+		{
+			name:     "without integrity",
+			setters:  []stun.Setter{username, stun.Fingerprint},
+			wantCode: stun.CodeBadRequest,
+		},
+		{
+			name:     "wrong ufrag",
+			setters:  []stun.Setter{stun.NewUsername("other:" + remote.Ufrag), stun.NewShortTermIntegrity(local.Pwd), stun.Fingerprint},
+			wantCode: stun.CodeUnauthorized,
+		},
+		{
+			name:     "wrong password",
+			setters:  []stun.Setter{username, stun.NewShortTermIntegrity("wrong password"), stun.Fingerprint},
+			wantCode: stun.CodeUnauthorized,
+		},
+		{
+			name:     "bad fingerprint",
+			setters:  []stun.Setter{username, stun.NewShortTermIntegrity(local.Pwd), stun.Fingerprint},
+			corrupt:  true,
+			wantCode: -1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+			if err != nil {
+				t.Fatalf("listening: %v", err)
+			}
+			defer conn.Close()
+
+			peer, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+			if err != nil {
+				t.Fatalf("listening: %v", err)
+			}
+			defer peer.Close()
+
+			req := stun.MustBuild(append([]stun.Setter{stun.TransactionID, stun.BindingRequest}, tt.setters...)...)
+			packet := append([]byte{}, req.Raw...)
+
+			if tt.corrupt {
+				packet[len(packet)-1] ^= 0xff
+			}
+
+			agent := NewICELite(local, &remote)
+
+			isSTUN, _ := agent.Handle(conn, packet, peer.LocalAddr())
+			if !isSTUN {
+				t.Fatal("Handle did not recognize a STUN message")
+			}
+
+			if got := agent.Selected() != nil; got != tt.selected {
+				t.Fatalf("Selected() != nil is %v, want %v", got, tt.selected)
+			}
+
+			peer.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+
+			buf := make([]byte, stunMaxPacketSize)
+
+			n, _, err := peer.ReadFrom(buf)
+			if tt.wantCode == -1 {
+				if err == nil {
+					t.Fatal("answered a message that must be discarded")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("reading the answer: %v", err)
+			}
+
+			resp := &stun.Message{Raw: buf[:n]}
+			if err := resp.Decode(); err != nil {
+				t.Fatalf("decoding the answer: %v", err)
+			}
+
+			if tt.wantCode == 0 {
+				if resp.Type != stun.BindingSuccess {
+					t.Fatalf("answer type = %s, want %s", resp.Type, stun.BindingSuccess)
+				}
+
+				return
+			}
+
+			var code stun.ErrorCodeAttribute
+			if err := code.GetFrom(resp); err != nil || code.Code != tt.wantCode {
+				t.Fatalf("answer error code = %v (%v), want %d", code.Code, err, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestParseICECandidate(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    ICECandidate
+		wantErr bool
+	}{
+		{
+			value: "candidate:1 1 udp 2130706431 192.0.2.1 5000 typ host",
+			want:  ICECandidate{Foundation: "1", Component: 1, Transport: "UDP", Priority: 2130706431, Address: "192.0.2.1", Port: 5000, Type: "host"},
+		},
+		{
+			value: "2 2 UDP 1694498815 203.0.113.7 6001 typ srflx raddr 10.0.0.2 rport 5001 generation 0",
+			want: ICECandidate{
+				Foundation: "2", Component: 2, Transport: "UDP", Priority: 1694498815, Address: "203.0.113.7", Port: 6001,
+				Type: "srflx", RelatedAddress: "10.0.0.2", RelatedPort: 5001,
+			},
+		},
+		{value: "1 1 udp 2130706431 192.0.2.1 5000 host", wantErr: true},
+		{value: "1 one udp 2130706431 192.0.2.1 5000 typ host", wantErr: true},
+		{value: "1 1 udp 4294967296 192.0.2.1 5000 typ host", wantErr: true},
+		{value: "1 1 udp 2130706431 192.0.2.1 port typ host", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ParseICECandidate(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseICECandidate() error = %v, want error %v", err, tt.wantErr)
+			}
+
+			if got != tt.want {
+				t.Fatalf("ParseICECandidate() = %+v, want %+v", got, tt.want)
+			}
+
+			if tt.wantErr {
+				return
+			}
+
+			if again, err := ParseICECandidate(got.String()); err != nil || again != got {
+				t.Fatalf("String() = %q does not round-trip: %+v, %v", got.String(), again, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,23 @@
+package sdp
+
+import (
+	"log/slog"
+	"sync/atomic"
+)
+
+var packageLogger atomic.Pointer[slog.Logger]
+
+// SetLogger sets the logger used when no WithLogger option is given, and by
+// the functions that take no options. Nothing is logged by default; a nil
+// logger restores that.
+func SetLogger(logger *slog.Logger) {
+	packageLogger.Store(logger)
+}
+
+func defaultLogger() *slog.Logger {
+	if logger := packageLogger.Load(); logger != nil {
+		return logger
+	}
+
+	return slog.New(slog.DiscardHandler)
+}
@@ -0,0 +1,31 @@
+package sdp
+
+import "net"
+
+// advertisedIP returns the address announced for the local ip, ignoring
+// STUN mappings.
+func (cfg *config) advertisedIP(ip net.IP) net.IP {
+	if external, ok := cfg.advertised[ip.String()]; ok {
+		return external
+	}
+
+	if external, ok := cfg.advertised[""]; ok {
+		return external
+	}
+
+	return ip
+}
+
+// advertisedAddr returns the address announced for the local addr: its
+// STUN mapping if one was found, or else the advertised IP with the same
+// port.
+func (cfg *config) advertisedAddr(addr *net.UDPAddr) *net.UDPAddr {
+	if mapped, ok := cfg.ports.mappedAddr(addr); ok {
+		return mapped
+	}
+
+	return &net.UDPAddr{
+		IP:   cfg.advertisedIP(addr.IP),
+		Port: addr.Port,
+	}
+}
@@ -3,12 +3,8 @@ package sdp
 import (
 	"fmt"
 	"net"
-	"strconv"
-	"strings"
-	"time"
 
 	"github.com/emiago/sipgo/sip"
-	"github.com/pion/sdp/v4"
 )
 
 type UDPConn interface {
@@ -16,117 +12,50 @@ type UDPConn interface {
 	Close() error
 }
 
-func RenegotiateSDP(req *sip.Request, connSIP, connRTP, connRTCP UDPConn) (*sip.Response, string, int, error) {
-	body := req.Body()
-	if len(body) == 0 {
-		return nil, "", 0, fmt.Errorf("no SDP in the request")
-	}
-
-	remoteSDP := &sdp.SessionDescription{}
-	if err := remoteSDP.Unmarshal(body); err != nil {
-		return nil, "", 0, fmt.Errorf("parsing remote SDP: %w", err)
-	}
-	localSDP, selectedFormat := negotiateLocalSDP(remoteSDP, connSIP, connRTP, connRTCP)
-
-	resp, err := createSDPResponse(localSDP, req, connSIP)
-	if err != nil {
-		errFinal := fmt.Errorf("creating SDP response: %w", err)
-		if err := connRTP.Close(); err != nil {
-			errFinal = fmt.Errorf("%w; closing RTP connection: %w", errFinal, err)
-		}
-
-		if err := connRTCP.Close(); err != nil {
-			errFinal = fmt.Errorf("%w; closing RTCP connection: %w", errFinal, err)
-		}
-
-		return nil, "", 0, errFinal
-	}
-
-	return resp, selectedFormat, ptimeDefault, nil
-}
-
-func NegotiateSDP(req *sip.Request, connSIP UDPConn) (*sip.Response, *net.UDPConn, *net.UDPConn, string, int, error) {
-	connRTP, connRTCP, err := generateNewRTPAndRTCP(connSIP)
-	if err != nil {
-		return nil, nil, nil, "", 0, fmt.Errorf("generating RTP and RTCP connections: %w", err)
-	}
-
-	resp, selectedFormat, pTime, err := RenegotiateSDP(req, connSIP, connRTP, connRTCP)
+func RenegotiateSDP(req *sip.Request, connSIP, connRTP, connRTCP UDPConn, opts ...Option) (*sip.Response, string, int, error) {
+	resp, result, err := Renegotiate(req, connSIP, connRTP, connRTCP, opts...)
 	if err != nil {
-		return nil, nil, nil, "", 0, fmt.Errorf("negotiating SDP: %w", err)
+		return nil, "", 0, err
 	}
 
-	return resp, connRTP, connRTCP, selectedFormat, pTime, nil
+	return resp, result.Format, result.Ptime, nil
 }
 
-func ObtainSelectedFormatAndPtime(body []byte) (string, int, *net.UDPAddr, *net.UDPAddr, error) {
-	var (
-		addrToRTCP,
-		addrToRTP *net.UDPAddr
-	)
+// NegotiateSDP answers the first audio stream of the offer in req with new
+// RTP and RTCP connections, allocating no RTCP one when rtcp-mux is agreed,
+// and rejects the other streams. The connections are nil when no audio
+// stream is accepted. Along with the selected format and ptime it returns
+// the telephone-event payload type agreed for DTMF, -1 if none.
+func NegotiateSDP(req *sip.Request, connSIP UDPConn, opts ...Option) (*sip.Response, *net.UDPConn, *net.UDPConn, string, int, int, error) {
+	cfg := newConfig(opts)
 
-	remoteSDP, err := unmarshalSDP(body)
+	resp, result, err := negotiate(req, connSIP, cfg, true)
 	if err != nil {
-		return "", 0, nil, nil, fmt.Errorf("unmarshaling SDP: %w", err)
-	}
-
-	if len(remoteSDP.MediaDescriptions) == 0 {
-		return "", 0, nil, nil, fmt.Errorf("no media descriptions in SDP")
+		return nil, nil, nil, "", 0, -1, fmt.Errorf("negotiating SDP: %w", err)
 	}
 
-	addrRTP := net.ParseIP(remoteSDP.Origin.UnicastAddress)
-	addrToRTP = &net.UDPAddr{
-		IP:   addrRTP,
-		Port: remoteSDP.MediaDescriptions[0].MediaName.Port.Value,
-	}
-
-	fmt.Printf("remoteSDP.Origin.UnicastAddress %s\n", remoteSDP.Origin.UnicastAddress)
-
-	if remoteSDP.ConnectionInformation != nil {
-		fmt.Printf("remoteSDP.ConnectionInformation.Address %s\n", remoteSDP.ConnectionInformation.Address)
-		addrRTP := net.ParseIP(remoteSDP.ConnectionInformation.Address.Address)
-		addrToRTP = &net.UDPAddr{
-			IP:   addrRTP,
-			Port: remoteSDP.MediaDescriptions[0].MediaName.Port.Value,
-		}
-	}
+	if len(result.Streams) == 0 {
+		cfg.logger.Debug("rejected every stream")
 
-	if len(remoteSDP.MediaDescriptions[0].MediaName.Formats) == 0 {
-		return "", 0, nil, nil, fmt.Errorf("no formats in media description")
+		return resp, nil, nil, "", 0, -1, nil
 	}
 
-	pTime := int(defFrameDur / time.Millisecond)
-
-	for _, attr := range remoteSDP.MediaDescriptions[0].Attributes {
-		if attr.Key == ptimeHeader {
-			v, err := strconv.Atoi(attr.Value)
-			if err == nil {
-				pTime = v
-			}
-
-			continue
-		}
-
-		if attr.Key == rtcpHeader {
-			v := strings.Split(attr.Value, " ")
-			if len(v) > 0 {
-				port, err := strconv.Atoi(v[0])
-				if err != nil {
-					addrToRTCP = nil
-
-					continue
-				}
+	cfg.logger.Debug("negotiated SDP",
+		"format", result.Format,
+		"ptime", result.Ptime,
+		"dtmf_payload_type", result.DTMFPayloadType,
+		"rtp", result.ConnRTP.LocalAddr(),
+		"rtcp_mux", result.RTCPMux,
+	)
 
-				addrToRTCP = &net.UDPAddr{
-					Port: port,
-				}
-			}
+	return resp, result.ConnRTP, result.ConnRTCP, result.Format, result.Ptime, result.DTMFPayloadType, nil
+}
 
-			if len(v) > 3 {
-				addrToRTCP.IP = net.ParseIP(v[3])
-			}
-		}
+func ObtainSelectedFormatAndPtime(body []byte, opts ...Option) (string, int, *net.UDPAddr, *net.UDPAddr, error) {
+	result, err := ObtainNegotiationResult(body, opts...)
+	if err != nil {
+		return "", 0, nil, nil, err
 	}
 
-	return remoteSDP.MediaDescriptions[0].MediaName.Formats[0], pTime, addrToRTP, addrToRTCP, nil
+	return result.Format, result.Ptime, result.RemoteRTP, result.RemoteRTCP, nil
 }
@@ -0,0 +1,70 @@
+package sdp
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/emiago/sipgo/sip"
+)
+
+func TestNegotiateSDPWithRTCPMux(t *testing.T) {
+	loopback := net.IPv4(127, 0, 0, 1)
+
+	connSIP, err := net.ListenUDP("udp", &net.UDPAddr{IP: loopback})
+	if err != nil {
+		t.Fatalf("listening: %v", err)
+	}
+	defer connSIP.Close()
+
+	// The only pair of the range cannot get its RTCP port.
+	taken, err := net.ListenUDP("udp", &net.UDPAddr{IP: loopback, Port: 32001})
+	if err != nil {
+		t.Fatalf("listening: %v", err)
+	}
+	defer taken.Close()
+
+	ports, err := NewPortAllocator(32000, 32001)
+	if err != nil {
+		t.Fatalf("NewPortAllocator: %v", err)
+	}
+
+	offer := strings.Join([]string{
+		"v=0",
+		"o=- 1 1 IN IP4 192.0.2.1",
+		"s=-",
+		"c=IN IP4 192.0.2.1",
+		"t=0 0",
+		"m=audio 5000 RTP/AVP 0 101",
+		"a=rtpmap:101 telephone-event/8000",
+		"a=rtcp-mux",
+		"m=audio 5002 RTP/AVP 8",
+	}, "\r\n") + "\r\n"
+
+	req := testRequest(sip.INVITE, sip.GenerateBranch())
+	req.AppendHeader(sip.NewHeader("Content-Type", "application/sdp"))
+	req.SetBody([]byte(offer))
+
+	resp, connRTP, connRTCP, format, _, dtmf, err := NegotiateSDP(req, connSIP, WithPortAllocator(ports))
+	if err != nil {
+		t.Fatalf("NegotiateSDP: %v", err)
+	}
+	defer connRTP.Close()
+
+	if connRTCP != nil {
+		t.Fatalf("RTCP connection on %s, want none with rtcp-mux", connRTCP.LocalAddr())
+	}
+
+	if port := connRTP.LocalAddr().(*net.UDPAddr).Port; port != 32000 || format != "0" || dtmf != 101 {
+		t.Fatalf("RTP on %d with format %s and DTMF %d, want 32000, 0 and 101", port, format, dtmf)
+	}
+
+	answer, err := unmarshalSDP(resp.Body())
+	if err != nil {
+		t.Fatalf("unmarshaling answer: %v", err)
+	}
+
+	if port := answer.MediaDescriptions[1].MediaName.Port.Value; port != 0 {
+		t.Fatalf("second m= line answered on %d, want it rejected", port)
+	}
+}
@@ -0,0 +1,226 @@
+package sdp
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"slices"
+	"time"
+
+	"github.com/pion/sdp/v4"
+)
+
+// Option customizes how SDP is generated and negotiated.
+type Option func(*config)
+
+type config struct {
+	codecs          *CodecRegistry
+	direction       Direction
+	offerMedia      []string // kinds of m= line to offer, nil means all registered ones
+	ports           *PortAllocator
+	noRTCPMux       bool
+	advertised      map[string]net.IP // external address per local one, "" for any
+	stunServer      string
+	stunTimeout     time.Duration
+	ice             *ICECredentials // nil unless ICE-lite is enabled
+	srtpSuites      []string        // SDES suites, none for plain RTP
+	localOffer      *sdp.SessionDescription
+	dtlsCert        *tls.Certificate // nil unless DTLS-SRTP is enabled
+	dtlsFingerprint Fingerprint
+	logger          *slog.Logger
+	t1, t2, t4      time.Duration
+	err             error // from options that failed, returned when negotiating
+}
+
+func newConfig(opts []Option) *config {
+	cfg := &config{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	if cfg.codecs == nil {
+		cfg.codecs = DefaultCodecRegistry()
+	}
+
+	if cfg.t1 <= 0 || cfg.t2 < cfg.t1 || cfg.t4 <= 0 {
+		cfg.t1, cfg.t2, cfg.t4 = DefaultT1, DefaultT2, DefaultT4
+	}
+
+	if cfg.logger == nil {
+		cfg.logger = defaultLogger()
+	}
+
+	if cfg.ports == nil {
+		cfg.ports = DefaultPortAllocator
+	}
+
+	if cfg.stunTimeout <= 0 {
+		cfg.stunTimeout = DefaultSTUNTimeout
+	}
+
+	if cfg.direction == "" {
+		cfg.direction = DirectionSendRecv
+	}
+
+	return cfg
+}
+
+// offeredMedia returns the kinds of m= line a local offer contains.
+func (cfg *config) offeredMedia() []string {
+	media := []string{}
+	for _, kind := range cfg.codecs.mediaTypes() {
+		if cfg.offerMedia == nil || slices.Contains(cfg.offerMedia, kind) {
+			media = append(media, kind)
+		}
+	}
+
+	return media
+}
+
+// WithCodecRegistry makes the negotiation consult the given registry instead of the default one.
+func WithCodecRegistry(registry *CodecRegistry) Option {
+	return func(cfg *config) {
+		cfg.codecs = registry
+	}
+}
+
+// WithDirection sets the direction offered locally and caps the one answered, e.g. sendonly to put the remote on hold.
+func WithDirection(direction Direction) Option {
+	return func(cfg *config) {
+		cfg.direction = direction
+	}
+}
+
+// WithPortAllocator makes RTP and RTCP connections be allocated from the given range.
+func WithPortAllocator(ports *PortAllocator) Option {
+	return func(cfg *config) {
+		cfg.ports = ports
+	}
+}
+
+// WithRTCPMux sets whether RTCP multiplexing with RTP on one port (RFC 5761)
+// is offered and accepted. It is by default.
+func WithRTCPMux(enabled bool) Option {
+	return func(cfg *config) {
+		cfg.noRTCPMux = !enabled
+	}
+}
+
+// WithAdvertisedAddress announces external instead of local in o=, c=,
+// a=rtcp, Via and Contact, e.g. the public address of a NAT with a static
+// mapping. Sockets still bind to local. A nil or unspecified local applies
+// to every interface without a mapping of its own.
+func WithAdvertisedAddress(local, external net.IP) Option {
+	return func(cfg *config) {
+		if cfg.advertised == nil {
+			cfg.advertised = map[string]net.IP{}
+		}
+
+		key := ""
+		if local != nil && !local.IsUnspecified() {
+			key = local.String()
+		}
+
+		cfg.advertised[key] = external
+	}
+}
+
+// WithSTUNServer makes every RTP and RTCP connection allocated send a STUN
+// binding request to server, a host:port, and advertise the mapping found.
+func WithSTUNServer(server string) Option {
+	return func(cfg *config) {
+		cfg.stunServer = server
+	}
+}
+
+// WithSTUNTimeout bounds how long a STUN server is waited for before falling
+// back to the advertised or local address. It is DefaultSTUNTimeout by default.
+func WithSTUNTimeout(timeout time.Duration) Option {
+	return func(cfg *config) {
+		cfg.stunTimeout = timeout
+	}
+}
+
+// WithICELite publishes ICE credentials and host candidates, plus server
+// reflexive ones for advertised addresses, in offers and in answers to
+// offers using ICE. Connectivity checks are answered with ICELite.
+// The credentials are generated once, when WithICELite is called, so the
+// option must be reused for the whole session.
+func WithICELite() Option {
+	credentials, err := NewICECredentials()
+
+	return func(cfg *config) {
+		if err != nil {
+			cfg.err = errors.Join(cfg.err, err)
+
+			return
+		}
+
+		cfg.ice = &credentials
+	}
+}
+
+// WithSRTP offers RTP/SAVP with an a=crypto line per suite, DefaultSRTPSuites
+// if none is given, and accepts RTP/SAVP offers using one of them. Plain
+// RTP/AVP offers are still accepted.
+func WithSRTP(suites ...string) Option {
+	return func(cfg *config) {
+		if len(suites) == 0 {
+			suites = DefaultSRTPSuites()
+		}
+
+		cfg.srtpSuites = suites
+	}
+}
+
+// WithLocalOffer gives the offer an answer being read responds to, so that
+// the SRTP keys of both sides can be returned. An offer that cannot be
+// parsed makes reading the answer fail.
+func WithLocalOffer(body []byte) Option {
+	return func(cfg *config) {
+		localOffer, err := unmarshalSDP(body)
+		if err != nil {
+			cfg.err = errors.Join(cfg.err, fmt.Errorf("unmarshaling local offer: %w", err))
+
+			return
+		}
+
+		cfg.localOffer = localOffer
+	}
+}
+
+// WithDTLS offers UDP/TLS/RTP/SAVPF with the fingerprint of cert and
+// a=setup:actpass, and accepts such offers, for DTLS-SRTP with
+// DTLSHandshake. It takes precedence over WithSRTP when offering. A cert
+// that cannot be fingerprinted makes negotiation fail.
+func WithDTLS(cert tls.Certificate) Option {
+	return func(cfg *config) {
+		fingerprint, err := NewFingerprint(cert)
+		if err != nil {
+			cfg.err = errors.Join(cfg.err, fmt.Errorf("fingerprinting DTLS certificate: %w", err))
+
+			return
+		}
+
+		cfg.dtlsCert = &cert
+		cfg.dtlsFingerprint = fingerprint
+	}
+}
+
+// WithLogger sends the debug logs of a call to logger instead of the one
+// set with SetLogger.
+func WithLogger(logger *slog.Logger) Option {
+	return func(cfg *config) {
+		cfg.logger = logger
+	}
+}
+
+// WithTransactionTimers replaces the T1, T2 and T4 estimates of RFC 3261
+// used by a TransactionLayer, e.g. on networks with a known round trip time.
+func WithTransactionTimers(t1, t2, t4 time.Duration) Option {
+	return func(cfg *config) {
+		cfg.t1, cfg.t2, cfg.t4 = t1, t2, t4
+	}
+}
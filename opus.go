@@ -0,0 +1,152 @@
+package sdp
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	opus                    = "opus"
+	opusMaxPlaybackRate     = 48000
+	opusDefaultFmtp         = "maxplaybackrate=48000;stereo=0;sprop-stereo=0;useinbandfec=1"
+	opusParamPlaybackRate   = "maxplaybackrate"
+	opusParamAverageBitrate = "maxaveragebitrate"
+	opusParamStereo         = "stereo"
+	opusParamSpropStereo    = "sprop-stereo"
+	opusParamInbandFEC      = "useinbandfec"
+	opusParamDTX            = "usedtx"
+	opusParamCBR            = "cbr"
+)
+
+func isOpus(codec Codec) bool {
+	return strings.EqualFold(codec.Name, opus)
+}
+
+// OpusParams are the a=fmtp parameters of RFC 7587. They describe the
+// receiver that writes them: what it can decode and what it prefers to get.
+type OpusParams struct {
+	MaxPlaybackRate   int // 0 means not present, i.e. 48000
+	MaxAverageBitrate int // 0 means not present
+	Stereo            bool
+	SpropStereo       bool
+	UseInbandFEC      bool
+	UseDTX            bool
+	CBR               bool
+}
+
+// ParseOpusParams reads the opus parameters of an fmtp line, ignoring unknown ones.
+func ParseOpusParams(fmtp string) OpusParams {
+	params := parseFmtp(fmtp)
+	flag := func(key string) bool {
+		return params[key] == "1"
+	}
+
+	number := func(key string) int {
+		value, err := strconv.Atoi(params[key])
+		if err != nil || value < 0 {
+			return 0
+		}
+
+		return value
+	}
+
+	return OpusParams{
+		MaxPlaybackRate:   number(opusParamPlaybackRate),
+		MaxAverageBitrate: number(opusParamAverageBitrate),
+		Stereo:            flag(opusParamStereo),
+		SpropStereo:       flag(opusParamSpropStereo),
+		UseInbandFEC:      flag(opusParamInbandFEC),
+		UseDTX:            flag(opusParamDTX),
+		CBR:               flag(opusParamCBR),
+	}
+}
+
+// String formats the parameters as an fmtp line.
+func (p OpusParams) String() string {
+	flag := func(value bool) int {
+		if value {
+			return 1
+		}
+
+		return 0
+	}
+
+	params := []string{}
+	if p.MaxPlaybackRate > 0 {
+		params = append(params, fmt.Sprintf("%s=%d", opusParamPlaybackRate, p.MaxPlaybackRate))
+	}
+
+	if p.MaxAverageBitrate > 0 {
+		params = append(params, fmt.Sprintf("%s=%d", opusParamAverageBitrate, p.MaxAverageBitrate))
+	}
+
+	params = append(params,
+		fmt.Sprintf("%s=%d", opusParamStereo, flag(p.Stereo)),
+		fmt.Sprintf("%s=%d", opusParamSpropStereo, flag(p.SpropStereo)),
+		fmt.Sprintf("%s=%d", opusParamInbandFEC, flag(p.UseInbandFEC)),
+	)
+
+	if p.UseDTX {
+		params = append(params, fmt.Sprintf("%s=1", opusParamDTX))
+	}
+
+	if p.CBR {
+		params = append(params, fmt.Sprintf("%s=1", opusParamCBR))
+	}
+
+	return strings.Join(params, ";")
+}
+
+func (p OpusParams) playbackRate() int {
+	if p.MaxPlaybackRate == 0 || p.MaxPlaybackRate > opusMaxPlaybackRate {
+		return opusMaxPlaybackRate
+	}
+
+	return p.MaxPlaybackRate
+}
+
+// answerOpusFmtp intersects the local preferences with the remote ones:
+// rates are lowered to the remote values, and stereo is only asked for or
+// announced when the remote side sends or accepts it.
+func answerOpusFmtp(local, remote string) string {
+	localParams := ParseOpusParams(local)
+	remoteParams := ParseOpusParams(remote)
+
+	answer := localParams
+	answer.MaxPlaybackRate = min(localParams.playbackRate(), remoteParams.playbackRate())
+	answer.Stereo = localParams.Stereo && remoteParams.SpropStereo
+	answer.SpropStereo = localParams.SpropStereo && remoteParams.Stereo
+
+	if localParams.MaxAverageBitrate > 0 && remoteParams.MaxAverageBitrate > 0 {
+		answer.MaxAverageBitrate = min(localParams.MaxAverageBitrate, remoteParams.MaxAverageBitrate)
+	}
+
+	return answer.String()
+}
+
+// OpusConfig tells the local opus encoder how to encode for the remote decoder.
+type OpusConfig struct {
+	MaxPlaybackRate   int
+	MaxAverageBitrate int // 0 means no limit
+	Stereo            bool
+	FEC               bool
+	DTX               bool
+	CBR               bool
+}
+
+// newOpusConfig derives the encoder settings from the agreed local fmtp and
+// the remote one, which states what the remote decoder wants.
+func newOpusConfig(local, remote string) *OpusConfig {
+	localParams := ParseOpusParams(local)
+	remoteParams := ParseOpusParams(remote)
+
+	return &OpusConfig{
+		MaxPlaybackRate:   min(localParams.playbackRate(), remoteParams.playbackRate()),
+		MaxAverageBitrate: remoteParams.MaxAverageBitrate,
+		Stereo:            remoteParams.Stereo && localParams.SpropStereo,
+		FEC:               remoteParams.UseInbandFEC,
+		DTX:               remoteParams.UseDTX,
+		CBR:               remoteParams.CBR,
+	}
+}
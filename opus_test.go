@@ -0,0 +1,24 @@
+package sdp
+
+import "testing"
+
+func TestParseOpusParams(t *testing.T) {
+	tests := []struct {
+		fmtp string
+		want OpusParams
+	}{
+		{fmtp: "", want: OpusParams{}},
+		{fmtp: opusDefaultFmtp, want: OpusParams{MaxPlaybackRate: 48000, UseInbandFEC: true}},
+		{fmtp: "stereo=1;sprop-stereo=1;usedtx=1;cbr=1", want: OpusParams{Stereo: true, SpropStereo: true, UseDTX: true, CBR: true}},
+		{fmtp: "maxplaybackrate=16000;maxaveragebitrate=20000", want: OpusParams{MaxPlaybackRate: 16000, MaxAverageBitrate: 20000}},
+		{fmtp: "maxplaybackrate=-1;maxaveragebitrate=fast;stereo=yes", want: OpusParams{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.fmtp, func(t *testing.T) {
+			if got := ParseOpusParams(tt.fmtp); got != tt.want {
+				t.Fatalf("ParseOpusParams(%q) = %+v, want %+v", tt.fmtp, got, tt.want)
+			}
+		})
+	}
+}
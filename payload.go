@@ -0,0 +1,189 @@
+package sdp
+
+import (
+	"cmp"
+	"strconv"
+	"strings"
+
+	"github.com/pion/sdp/v4"
+)
+
+// staticPayloadTypes are the payload types assigned by RFC 3551 that may be
+// used without an a=rtpmap line.
+var staticPayloadTypes = map[uint8]Codec{
+	0:  {Name: "PCMU", PayloadType: 0, ClockRate: 8000, Channels: 1},
+	3:  {Name: "GSM", PayloadType: 3, ClockRate: 8000, Channels: 1},
+	4:  {Name: "G723", PayloadType: 4, ClockRate: 8000, Channels: 1},
+	5:  {Name: "DVI4", PayloadType: 5, ClockRate: 8000, Channels: 1},
+	6:  {Name: "DVI4", PayloadType: 6, ClockRate: 16000, Channels: 1},
+	7:  {Name: "LPC", PayloadType: 7, ClockRate: 8000, Channels: 1},
+	8:  {Name: "PCMA", PayloadType: 8, ClockRate: 8000, Channels: 1},
+	9:  {Name: "G722", PayloadType: 9, ClockRate: 8000, Channels: 1},
+	10: {Name: "L16", PayloadType: 10, ClockRate: 44100, Channels: 2},
+	11: {Name: "L16", PayloadType: 11, ClockRate: 44100, Channels: 1},
+	12: {Name: "QCELP", PayloadType: 12, ClockRate: 8000, Channels: 1},
+	13: {Name: "CN", PayloadType: 13, ClockRate: 8000, Channels: 1},
+	14: {Name: "MPA", PayloadType: 14, ClockRate: 90000, Channels: 1},
+	15: {Name: "G728", PayloadType: 15, ClockRate: 8000, Channels: 1},
+	16: {Name: "DVI4", PayloadType: 16, ClockRate: 11025, Channels: 1},
+	17: {Name: "DVI4", PayloadType: 17, ClockRate: 22050, Channels: 1},
+	18: {Name: "G729", PayloadType: 18, ClockRate: 8000, Channels: 1},
+	25: {Name: "CelB", PayloadType: 25, ClockRate: 90000, Channels: 1},
+	26: {Name: "JPEG", PayloadType: 26, ClockRate: 90000, Channels: 1},
+	28: {Name: "nv", PayloadType: 28, ClockRate: 90000, Channels: 1},
+	31: {Name: "H261", PayloadType: 31, ClockRate: 90000, Channels: 1},
+	32: {Name: "MPV", PayloadType: 32, ClockRate: 90000, Channels: 1},
+	33: {Name: "MP2T", PayloadType: 33, ClockRate: 90000, Channels: 1},
+	34: {Name: "H263", PayloadType: 34, ClockRate: 90000, Channels: 1},
+}
+
+// parseRemoteFormats describes every format of the m= line using its a=rtpmap
+// and a=fmtp lines, falling back to the static assignments of RFC 3551.
+// Formats that cannot be described are left out.
+func parseRemoteFormats(md *sdp.MediaDescription) []Codec {
+	rtpmaps := map[uint8]Codec{}
+	fmtps := map[uint8]string{}
+	feedbacks := map[string][]string{}
+
+	for _, attr := range md.Attributes {
+		switch attr.Key {
+		case rtpmapHeader:
+			if codec, ok := parseRtpmap(attr.Value); ok {
+				rtpmaps[codec.PayloadType] = codec
+			}
+		case fmtpHeader:
+			format, params, _ := strings.Cut(attr.Value, " ")
+			if payloadType, err := strconv.ParseUint(format, 10, 8); err == nil {
+				fmtps[uint8(payloadType)] = strings.TrimSpace(params)
+			}
+		case rtcpFbHeader:
+			format, feedback, _ := strings.Cut(attr.Value, " ")
+			feedbacks[format] = append(feedbacks[format], strings.TrimSpace(feedback))
+		}
+	}
+
+	formats := []Codec{}
+
+	for _, format := range md.MediaName.Formats {
+		payloadType, err := strconv.ParseUint(format, 10, 8)
+		if err != nil {
+			continue
+		}
+
+		codec, ok := rtpmaps[uint8(payloadType)]
+		if !ok {
+			codec, ok = staticPayloadTypes[uint8(payloadType)]
+		}
+
+		if !ok {
+			continue
+		}
+
+		codec.Media = md.MediaName.Media
+		codec.Fmtp = fmtps[codec.PayloadType]
+		codec.RTCPFeedback = append(feedbacks["*"], feedbacks[format]...)
+		formats = append(formats, codec)
+	}
+
+	return formats
+}
+
+// parseRtpmap parses "<payload type> <encoding name>/<clock rate>[/<channels>]".
+func parseRtpmap(value string) (Codec, bool) {
+	format, encoding, ok := strings.Cut(strings.TrimSpace(value), " ")
+	if !ok {
+		return Codec{}, false
+	}
+
+	payloadType, err := strconv.ParseUint(format, 10, 8)
+	if err != nil {
+		return Codec{}, false
+	}
+
+	parts := strings.Split(strings.TrimSpace(encoding), "/")
+	if len(parts) < 2 || parts[0] == "" {
+		return Codec{}, false
+	}
+
+	clockRate, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return Codec{}, false
+	}
+
+	channels := 1
+	if len(parts) > 2 {
+		channels, err = strconv.Atoi(parts[2])
+		if err != nil {
+			return Codec{}, false
+		}
+	}
+
+	return Codec{
+		Name:        parts[0],
+		PayloadType: uint8(payloadType),
+		ClockRate:   clockRate,
+		Channels:    channels,
+	}, true
+}
+
+// match returns the most preferred registered codec with the same encoding
+// name, clock rate and channels as the remote one, carrying the remote
+// payload type as required by RFC 3264 for the answer.
+func (r *CodecRegistry) match(remote Codec) (Codec, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, codec := range r.codecs {
+		if codec.MediaType() != remote.MediaType() ||
+			!strings.EqualFold(codec.Name, remote.Name) ||
+			codec.ClockRate != remote.ClockRate ||
+			codec.Channels != remote.Channels {
+			continue
+		}
+
+		if isH264(codec) && !h264Compatible(codec.Fmtp, remote.Fmtp) {
+			continue
+		}
+
+		codec.PayloadType = remote.PayloadType
+
+		return codec, true
+	}
+
+	return Codec{}, false
+}
+
+// negotiateCodecs returns the registered codecs found in the m= line, in the
+// remote order, with the remote payload types and the fmtp parameters
+// agreed with the remote side.
+func negotiateCodecs(registry *CodecRegistry, md *sdp.MediaDescription) []Codec {
+	codecs := []Codec{}
+
+	for _, remoteCodec := range parseRemoteFormats(md) {
+		codec, ok := registry.match(remoteCodec)
+		if !ok {
+			continue
+		}
+
+		if isTelephoneEvent(codec) && remoteCodec.Fmtp != "" {
+			codec.Fmtp = intersectEvents(cmp.Or(codec.Fmtp, defaultEvents), remoteCodec.Fmtp)
+			if codec.Fmtp == "" {
+				continue // no event in common, RFC 4733 section 7.1.1
+			}
+		}
+
+		if isOpus(codec) {
+			codec.Fmtp = answerOpusFmtp(codec.Fmtp, remoteCodec.Fmtp)
+		}
+
+		if isH264(codec) {
+			codec.Fmtp = answerH264Fmtp(codec.Fmtp, remoteCodec.Fmtp)
+		}
+
+		codec.RTCPFeedback = intersectFeedback(codec.RTCPFeedback, remoteCodec.RTCPFeedback)
+
+		codecs = append(codecs, codec)
+	}
+
+	return selectTelephoneEvent(codecs)
+}
@@ -0,0 +1,92 @@
+package sdp
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/pion/sdp/v4"
+)
+
+func TestParseRtpmap(t *testing.T) {
+	tests := []struct {
+		value string
+		want  Codec
+		ok    bool
+	}{
+		{value: "0 PCMU/8000", want: Codec{Name: "PCMU", PayloadType: 0, ClockRate: 8000, Channels: 1}, ok: true},
+		{value: "111 opus/48000/2", want: Codec{Name: opus, PayloadType: 111, ClockRate: 48000, Channels: 2}, ok: true},
+		{value: " 101  telephone-event/8000 ", want: Codec{Name: telephoneEvent, PayloadType: 101, ClockRate: 8000, Channels: 1}, ok: true},
+		{value: "PCMU/8000"},
+		{value: "256 PCMU/8000"},
+		{value: "0 PCMU"},
+		{value: "0 /8000"},
+		{value: "0 PCMU/rate"},
+		{value: "111 opus/48000/two"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, ok := parseRtpmap(tt.value)
+			if ok != tt.ok || got.Name != tt.want.Name || got.PayloadType != tt.want.PayloadType ||
+				got.ClockRate != tt.want.ClockRate || got.Channels != tt.want.Channels {
+				t.Fatalf("parseRtpmap(%q) = %+v, %v, want %+v, %v", tt.value, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestNegotiateCodecs(t *testing.T) {
+	offer := func(formats []string, rtpmaps ...string) *sdp.MediaDescription {
+		md := &sdp.MediaDescription{MediaName: sdp.MediaName{Media: mediaAudio, Formats: formats}}
+		for _, rtpmap := range rtpmaps {
+			md.Attributes = append(md.Attributes, sdp.Attribute{Key: rtpmapHeader, Value: rtpmap})
+		}
+
+		return md
+	}
+
+	tests := []struct {
+		name    string
+		md      *sdp.MediaDescription
+		rtpmaps []string // of the answer, in order
+	}{
+		{
+			name:    "opus on 111",
+			md:      offer([]string{"111", "0"}, "111 opus/48000/2"),
+			rtpmaps: []string{"111 opus/48000/2", "0 PCMU/8000"},
+		},
+		{
+			name:    "PCMA on a dynamic payload type",
+			md:      offer([]string{"98"}, "98 PCMA/8000"),
+			rtpmaps: []string{"98 PCMA/8000"},
+		},
+		{
+			name:    "telephone-event on 96",
+			md:      offer([]string{"0", "96"}, "96 telephone-event/8000"),
+			rtpmaps: []string{"0 PCMU/8000", "96 telephone-event/8000"},
+		},
+		{
+			name:    "H.264 on 96",
+			md:      offer([]string{"96", "8"}, "96 H264/90000"),
+			rtpmaps: []string{"8 PCMA/8000"},
+		},
+		{
+			name:    "static payload type without rtpmap",
+			md:      offer([]string{"8", "9"}),
+			rtpmaps: []string{"8 PCMA/8000", "9 G722/8000"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rtpmaps := []string{}
+			for _, codec := range negotiateCodecs(DefaultCodecRegistry(), tt.md) {
+				rtpmaps = append(rtpmaps, codec.Rtpmap().Value)
+			}
+
+			if !slices.Equal(rtpmaps, tt.rtpmaps) {
+				t.Fatalf("negotiated %q, want %q", rtpmaps, tt.rtpmaps)
+			}
+		})
+	}
+}
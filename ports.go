@@ -0,0 +1,284 @@
+package sdp
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultMinRTPPort = 10000
+	DefaultMaxRTPPort = 20000
+)
+
+var (
+	// ErrNoPortsAvailable is returned when every even port of the range is taken.
+	ErrNoPortsAvailable = errors.New("no RTP ports available")
+	// ErrInvalidRTPHost is returned when the host to bind RTP on is not an IP,
+	// or is unspecified without an advertised address.
+	ErrInvalidRTPHost = errors.New("invalid RTP host")
+	// ErrNotUDP is returned when a connection is not bound to a UDP address.
+	ErrNotUDP = errors.New("connection is not bound to a UDP address")
+)
+
+// SocketError describes a media connection that could not be bound.
+type SocketError struct {
+	Socket string // "RTP", "RTCP" or "temporary RTP"
+	Addr   *net.UDPAddr
+	Err    error
+}
+
+func (e *SocketError) Error() string {
+	if e.Addr == nil {
+		return fmt.Sprintf("binding %s socket: %v", e.Socket, e.Err)
+	}
+
+	return fmt.Sprintf("binding %s socket on %s: %v", e.Socket, e.Addr, e.Err)
+}
+
+func (e *SocketError) Unwrap() error {
+	return e.Err
+}
+
+// DefaultPortAllocator is used when no PortAllocator is given with WithPortAllocator.
+var DefaultPortAllocator = &PortAllocator{
+	minPort: DefaultMinRTPPort,
+	maxPort: DefaultMaxRTPPort,
+	next:    DefaultMinRTPPort,
+	inUse:   map[int]*allocation{},
+}
+
+// PortAllocator binds RTP on even ports of a range and RTCP on the next odd
+// port, as recommended by RFC 3550 section 11. A pair is released once both
+// of its connections are closed. It is safe for concurrent use.
+type PortAllocator struct {
+	mu      sync.Mutex
+	minPort int
+	maxPort int
+	next    int
+	inUse   map[int]*allocation
+}
+
+type allocation struct {
+	connRTP    *net.UDPConn
+	connRTCP   *net.UDPConn
+	mappedRTP  *net.UDPAddr // found with STUN, nil if unknown
+	mappedRTCP *net.UDPAddr
+	since      time.Time
+
+	// o= line of the descriptions sent for this pair, see nextOrigin.
+	originKnown   bool
+	originID      uint64
+	originVersion uint64
+}
+
+// Allocation is a pair of ports handed out and not closed yet.
+type Allocation struct {
+	RTPPort  int
+	RTCPPort int // 0 when RTCP is multiplexed on the RTP port
+	Since    time.Time
+}
+
+// NewPortAllocator returns an allocator for the ports between minPort and
+// maxPort, both included.
+func NewPortAllocator(minPort, maxPort int) (*PortAllocator, error) {
+	if minPort%2 != 0 {
+		minPort++
+	}
+
+	if minPort <= 0 || maxPort > 65535 || maxPort < minPort+1 {
+		return nil, fmt.Errorf("invalid RTP port range %d-%d", minPort, maxPort)
+	}
+
+	return &PortAllocator{
+		minPort: minPort,
+		maxPort: maxPort,
+		next:    minPort,
+		inUse:   map[int]*allocation{},
+	}, nil
+}
+
+// Allocate binds a pair of RTP and RTCP connections on the IP address conn
+// is bound to, trying the next even port when either one is taken.
+func (a *PortAllocator) Allocate(conn UDPConn) (*net.UDPConn, *net.UDPConn, error) {
+	return a.allocate(conn, true)
+}
+
+// AllocateRTP binds an RTP connection only, for streams that multiplex RTCP
+// on it. The odd port after it is left free.
+func (a *PortAllocator) AllocateRTP(conn UDPConn) (*net.UDPConn, error) {
+	connRTP, _, err := a.allocate(conn, false)
+
+	return connRTP, err
+}
+
+func (a *PortAllocator) allocate(conn UDPConn, withRTCP bool) (*net.UDPConn, *net.UDPConn, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.sweep()
+
+	var errLast error
+
+	attempts := (a.maxPort - a.minPort + 1) / 2
+	for range attempts {
+		port := a.next
+
+		a.next += 2
+		if a.next+1 > a.maxPort {
+			a.next = a.minPort
+		}
+
+		if _, ok := a.inUse[port]; ok {
+			continue
+		}
+
+		connRTP, err := createConnRTP(conn, port)
+		if errors.Is(err, ErrNotUDP) {
+			return nil, nil, err
+		}
+
+		if err != nil {
+			errLast = err
+
+			continue
+		}
+
+		var connRTCP *net.UDPConn
+		if withRTCP {
+			connRTCP, err = createConnRTCP(conn, connRTP)
+			if err != nil {
+				errLast = err
+				connRTP.Close()
+
+				continue
+			}
+		}
+
+		a.inUse[port] = &allocation{
+			connRTP:  connRTP,
+			connRTCP: connRTCP,
+			since:    time.Now(),
+		}
+
+		return connRTP, connRTCP, nil
+	}
+
+	if errLast != nil {
+		return nil, nil, fmt.Errorf("%w in %d-%d: %w", ErrNoPortsAvailable, a.minPort, a.maxPort, errLast)
+	}
+
+	return nil, nil, fmt.Errorf("%w in %d-%d", ErrNoPortsAvailable, a.minPort, a.maxPort)
+}
+
+// Allocations returns the pairs still open, oldest first. A pair open for
+// longer than any call should last has been leaked by its owner.
+func (a *PortAllocator) Allocations() []Allocation {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.sweep()
+
+	allocations := []Allocation{}
+	for port, alloc := range a.inUse {
+		allocation := Allocation{
+			RTPPort: port,
+			Since:   alloc.since,
+		}
+
+		if alloc.connRTCP != nil && !isClosed(alloc.connRTCP) {
+			allocation.RTCPPort = port + 1
+		}
+
+		allocations = append(allocations, allocation)
+	}
+
+	sort.Slice(allocations, func(i, j int) bool {
+		return allocations[i].Since.Before(allocations[j].Since)
+	})
+
+	return allocations
+}
+
+// setMapped records the server-reflexive address of an allocated connection.
+func (a *PortAllocator) setMapped(conn *net.UDPConn, mapped *net.UDPAddr) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	port := conn.LocalAddr().(*net.UDPAddr).Port
+	if alloc, ok := a.inUse[port]; ok && alloc.connRTP == conn {
+		alloc.mappedRTP = mapped
+	} else if alloc, ok := a.inUse[port-1]; ok && alloc.connRTCP == conn {
+		alloc.mappedRTCP = mapped
+	}
+}
+
+// mappedAddr returns the server-reflexive address recorded for the local
+// address of an allocated connection.
+func (a *PortAllocator) mappedAddr(addr *net.UDPAddr) (*net.UDPAddr, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	sameAddr := func(conn *net.UDPConn) bool {
+		return conn != nil && conn.LocalAddr().(*net.UDPAddr).IP.Equal(addr.IP)
+	}
+
+	if alloc, ok := a.inUse[addr.Port]; ok && alloc.mappedRTP != nil && sameAddr(alloc.connRTP) {
+		return alloc.mappedRTP, true
+	}
+
+	if alloc, ok := a.inUse[addr.Port-1]; ok && alloc.mappedRTCP != nil && sameAddr(alloc.connRTCP) {
+		return alloc.mappedRTCP, true
+	}
+
+	return nil, false
+}
+
+// nextOrigin returns the o= session id and version of a description sent
+// for the pair whose RTP connection is bound on addr. The id stays the same
+// for the pair and the version grows with every call, as RFC 4566 section
+// 5.2 requires from a re-INVITE answered without a Session. Connections that
+// were not allocated get a new random id every time.
+func (a *PortAllocator) nextOrigin(addr *net.UDPAddr) (uint64, uint64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	alloc, ok := a.inUse[addr.Port]
+	if !ok || !alloc.connRTP.LocalAddr().(*net.UDPAddr).IP.Equal(addr.IP) {
+		return uint64(rand.Uint32()), uint64(rand.Uint32())
+	}
+
+	if alloc.originKnown {
+		alloc.originVersion++
+	} else {
+		alloc.originKnown = true
+		alloc.originID = uint64(rand.Uint32())
+		alloc.originVersion = alloc.originID
+	}
+
+	return alloc.originID, alloc.originVersion
+}
+
+// sweep releases the pairs whose connections have all been closed.
+func (a *PortAllocator) sweep() {
+	for port, alloc := range a.inUse {
+		if isClosed(alloc.connRTP) && (alloc.connRTCP == nil || isClosed(alloc.connRTCP)) {
+			delete(a.inUse, port)
+		}
+	}
+}
+
+// isClosed reports whether Close was called on conn, without touching its
+// deadlines or buffers.
+func isClosed(conn *net.UDPConn) bool {
+	rawConn, err := conn.SyscallConn()
+	if err != nil {
+		return true
+	}
+
+	return rawConn.Control(func(uintptr) {}) != nil
+}
@@ -0,0 +1,129 @@
+package sdp
+
+import (
+	"errors"
+	"net"
+	"slices"
+	"testing"
+)
+
+func TestNewPortAllocator(t *testing.T) {
+	tests := []struct {
+		minPort, maxPort int
+		wantMin          int
+		wantErr          bool
+	}{
+		{minPort: 10000, maxPort: 20000, wantMin: 10000},
+		{minPort: 10001, maxPort: 10003, wantMin: 10002},
+		{minPort: 10000, maxPort: 10001, wantMin: 10000},
+		{minPort: 10000, maxPort: 10000, wantErr: true},
+		{minPort: 10001, maxPort: 10002, wantErr: true},
+		{minPort: 0, maxPort: 20000, wantErr: true},
+		{minPort: -2, maxPort: 20000, wantErr: true},
+		{minPort: 60000, maxPort: 65536, wantErr: true},
+		{minPort: 20000, maxPort: 10000, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		allocator, err := NewPortAllocator(tt.minPort, tt.maxPort)
+		if (err != nil) != tt.wantErr {
+			t.Fatalf("NewPortAllocator(%d, %d) error = %v, want error %v", tt.minPort, tt.maxPort, err, tt.wantErr)
+		}
+
+		if err == nil && allocator.minPort != tt.wantMin {
+			t.Fatalf("NewPortAllocator(%d, %d) starts at %d, want %d", tt.minPort, tt.maxPort, allocator.minPort, tt.wantMin)
+		}
+	}
+}
+
+func TestPortAllocator(t *testing.T) {
+	loopback := net.IPv4(127, 0, 0, 1)
+
+	listen := func(port int) *net.UDPConn {
+		conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: loopback, Port: port})
+		if err != nil {
+			t.Fatalf("listening on %d: %v", port, err)
+		}
+
+		t.Cleanup(func() { conn.Close() })
+
+		return conn
+	}
+
+	port := func(conn *net.UDPConn) int {
+		return conn.LocalAddr().(*net.UDPAddr).Port
+	}
+
+	connSIP := listen(0)
+
+	allocator, err := NewPortAllocator(31000, 31007)
+	if err != nil {
+		t.Fatalf("NewPortAllocator: %v", err)
+	}
+
+	// Someone else holds the RTP port of the first pair and the RTCP port of
+	// the second one.
+	listen(31000)
+	listen(31003)
+
+	connRTP, connRTCP, err := allocator.Allocate(connSIP)
+	if err != nil {
+		t.Fatalf("Allocate: %v", err)
+	}
+
+	if port(connRTP) != 31004 || port(connRTCP) != 31005 {
+		t.Fatalf("allocated %d and %d, want 31004 and 31005", port(connRTP), port(connRTCP))
+	}
+
+	if !connRTP.LocalAddr().(*net.UDPAddr).IP.Equal(loopback) {
+		t.Fatalf("bound on %s, want the address of the SIP connection", connRTP.LocalAddr())
+	}
+
+	connMux, err := allocator.AllocateRTP(connSIP)
+	if err != nil {
+		t.Fatalf("AllocateRTP: %v", err)
+	}
+
+	if port(connMux) != 31006 {
+		t.Fatalf("allocated %d, want 31006", port(connMux))
+	}
+
+	if _, _, err := allocator.Allocate(connSIP); !errors.Is(err, ErrNoPortsAvailable) {
+		t.Fatalf("Allocate() on a full range: error = %v, want %v", err, ErrNoPortsAvailable)
+	}
+
+	// Both pairs may have been handed out within the resolution of the clock.
+	allocations := allocator.Allocations()
+	slices.SortFunc(allocations, func(a, b Allocation) int { return a.RTPPort - b.RTPPort })
+
+	if len(allocations) != 2 ||
+		allocations[0].RTPPort != 31004 || allocations[0].RTCPPort != 31005 ||
+		allocations[1].RTPPort != 31006 || allocations[1].RTCPPort != 0 {
+		t.Fatalf("Allocations() = %+v, want 31004-31005 then 31006 alone", allocations)
+	}
+
+	connRTP.Close()
+
+	if allocations := allocator.Allocations(); len(allocations) != 2 {
+		t.Fatalf("Allocations() = %+v, want the pair kept until RTCP is closed too", allocations)
+	}
+
+	connRTCP.Close()
+
+	if allocations := allocator.Allocations(); len(allocations) != 1 || allocations[0].RTPPort != 31006 {
+		t.Fatalf("Allocations() = %+v, want 31006 only", allocations)
+	}
+
+	connRTP, connRTCP, err = allocator.Allocate(connSIP)
+	if err != nil {
+		t.Fatalf("Allocate after releasing a pair: %v", err)
+	}
+	defer connRTP.Close()
+	defer connRTCP.Close()
+
+	if port(connRTP) != 31004 {
+		t.Fatalf("allocated %d, want the released 31004", port(connRTP))
+	}
+
+	connMux.Close()
+}
@@ -0,0 +1,107 @@
+package sdp
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/pion/sdp/v4"
+)
+
+const minptimeHeader = "minptime"
+
+// parsePtimes returns the a=ptime and a=maxptime values of the m= line, 0
+// when absent or malformed.
+func parsePtimes(md *sdp.MediaDescription) (int, int) {
+	ptime, maxptime := 0, 0
+
+	for _, attr := range md.Attributes {
+		switch attr.Key {
+		case ptimeHeader:
+			if v, err := strconv.Atoi(attr.Value); err == nil && v > 0 {
+				ptime = v
+			}
+		case maxptimeHeader:
+			if v, err := strconv.Atoi(attr.Value); err == nil && v > 0 {
+				maxptime = v
+			}
+		}
+	}
+
+	return ptime, maxptime
+}
+
+// agreedMaxptime returns the lowest of the codec limit and the remote
+// a=maxptime, 0 when neither is set.
+func agreedMaxptime(codec Codec, remoteMaxptime int) int {
+	switch {
+	case codec.MaxPtime == 0:
+		return remoteMaxptime
+	case remoteMaxptime == 0:
+		return codec.MaxPtime
+	}
+
+	return min(codec.MaxPtime, remoteMaxptime)
+}
+
+// offeredMaxptime returns the a=maxptime of an m= line offering codecs: the
+// smallest limit among them, so that every one of them can meet it, or 0 if
+// none has a limit.
+func offeredMaxptime(codecs []Codec) int {
+	maxptime := 0
+	for _, codec := range codecs {
+		if codec.MaxPtime > 0 && (maxptime == 0 || codec.MaxPtime < maxptime) {
+			maxptime = codec.MaxPtime
+		}
+	}
+
+	return maxptime
+}
+
+// agreedPtime honours the remote a=ptime, falling back to the codec
+// preference, then clamps it to the codec limits and the remote a=maxptime.
+func agreedPtime(codec Codec, remotePtime, remoteMaxptime int) int {
+	ptime := remotePtime
+	if ptime == 0 {
+		ptime = codec.Ptime
+	}
+
+	if ptime == 0 {
+		ptime = ptimeDefault
+	}
+
+	if codec.MinPtime > 0 && ptime < codec.MinPtime {
+		ptime = codec.MinPtime
+	}
+
+	if maxptime := agreedMaxptime(codec, remoteMaxptime); maxptime > 0 && ptime > maxptime {
+		ptime = maxptime
+	}
+
+	return ptime
+}
+
+// ptimeAttributes describes the packetization of an audio m= line.
+func ptimeAttributes(codec Codec, ptime, maxptime int) []sdp.Attribute {
+	attrs := []sdp.Attribute{
+		{
+			Key:   ptimeHeader,
+			Value: fmt.Sprint(ptime),
+		},
+	}
+
+	if codec.MinPtime > 0 {
+		attrs = append(attrs, sdp.Attribute{
+			Key:   minptimeHeader,
+			Value: fmt.Sprint(codec.MinPtime),
+		})
+	}
+
+	if maxptime > 0 {
+		attrs = append(attrs, sdp.Attribute{
+			Key:   maxptimeHeader,
+			Value: fmt.Sprint(maxptime),
+		})
+	}
+
+	return attrs
+}
@@ -0,0 +1,24 @@
+package sdp
+
+import "testing"
+
+func TestOfferedMaxptime(t *testing.T) {
+	tests := []struct {
+		name   string
+		codecs []Codec
+		want   int
+	}{
+		{name: "default audio codecs", codecs: DefaultCodecRegistry().MediaCodecs(mediaAudio), want: 60},
+		{name: "opus only", codecs: []Codec{{Name: opus, MaxPtime: 120}, {Name: telephoneEvent}}, want: 120},
+		{name: "without limits", codecs: []Codec{{Name: "PCMU"}, {Name: telephoneEvent}}, want: 0},
+		{name: "limit after the first codec", codecs: []Codec{{Name: "PCMU"}, {Name: "PCMA", MaxPtime: 40}}, want: 40},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := offeredMaxptime(tt.codecs); got != tt.want {
+				t.Fatalf("offeredMaxptime() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,174 @@
+package sdp
+
+import (
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/emiago/sipgo/sip"
+)
+
+// NegotiationResult is the outcome of an SDP exchange. The embedded
+// StreamResult is the first accepted audio stream, or the first accepted
+// stream of any kind when there is no audio; it is zero if nothing was
+// accepted.
+type NegotiationResult struct {
+	StreamResult
+	Streams   []StreamResult // every accepted stream, in m= line order
+	LocalSDP  []byte
+	RemoteSDP []byte
+}
+
+func newNegotiationResult(streams []StreamResult, localSDP, remoteSDP []byte) *NegotiationResult {
+	result := &NegotiationResult{
+		Streams:   streams,
+		LocalSDP:  localSDP,
+		RemoteSDP: remoteSDP,
+	}
+
+	for _, stream := range streams {
+		if stream.Media == mediaAudio {
+			result.StreamResult = stream
+
+			return result
+		}
+	}
+
+	if len(streams) > 0 {
+		result.StreamResult = streams[0]
+	}
+
+	return result
+}
+
+// Negotiate answers the offer in req, allocating a pair of RTP and RTCP
+// connections per accepted stream, or an RTP one only when RTCP is
+// multiplexed. On error no connection is left open.
+func Negotiate(req *sip.Request, connSIP UDPConn, opts ...Option) (*sip.Response, *NegotiationResult, error) {
+	return negotiate(req, connSIP, newConfig(opts), false)
+}
+
+// negotiate implements Negotiate. With firstAudioOnly, connections are
+// allocated for the first accepted audio m= line only and the other m= lines
+// are rejected, as the legacy NegotiateSDP answers.
+func negotiate(req *sip.Request, connSIP UDPConn, cfg *config, firstAudioOnly bool) (*sip.Response, *NegotiationResult, error) {
+	allocated := []StreamResult{}
+	conns := func(_ int, media string, rtcpMux bool) (UDPConn, UDPConn, error) {
+		if firstAudioOnly && (media != mediaAudio || len(allocated) > 0) {
+			return nil, nil, nil
+		}
+
+		if rtcpMux {
+			connRTP, err := generateNewRTP(connSIP, cfg)
+			if err != nil {
+				return nil, nil, fmt.Errorf("generating RTP connection: %w", err)
+			}
+
+			allocated = append(allocated, StreamResult{ConnRTP: connRTP})
+
+			return connRTP, nil, nil
+		}
+
+		connRTP, connRTCP, err := generateNewRTPAndRTCP(connSIP, cfg)
+		if err != nil {
+			return nil, nil, fmt.Errorf("generating RTP and RTCP connections: %w", err)
+		}
+
+		allocated = append(allocated, StreamResult{ConnRTP: connRTP, ConnRTCP: connRTCP})
+
+		return connRTP, connRTCP, nil
+	}
+
+	resp, result, err := answerOffer(req, connSIP, cfg, conns)
+	if err != nil {
+		return nil, nil, errors.Join(err, closeStreams(allocated))
+	}
+
+	return resp, result, nil
+}
+
+// Renegotiate answers the offer in req, typically a re-INVITE, with the
+// given connections for the first audio stream; other streams are rejected.
+// connRTCP is closed when rtcp-mux is agreed, and both connections are
+// closed if the answer cannot be created.
+func Renegotiate(req *sip.Request, connSIP, connRTP, connRTCP UDPConn, opts ...Option) (*sip.Response, *NegotiationResult, error) {
+	resp, result, err := answerOffer(req, connSIP, newConfig(opts), singleStreamConns(connRTP, connRTCP))
+	if err != nil {
+		errFinal := err
+		if connRTP != nil {
+			if err := connRTP.Close(); err != nil {
+				errFinal = fmt.Errorf("%w; closing RTP connection: %w", errFinal, err)
+			}
+		}
+
+		if connRTCP != nil {
+			if err := connRTCP.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+				errFinal = fmt.Errorf("%w; closing RTCP connection: %w", errFinal, err)
+			}
+		}
+
+		return nil, nil, errFinal
+	}
+
+	return resp, result, nil
+}
+
+// ObtainNegotiationResult reads a remote description, typically the answer
+// to a local offer, as seen from the local side.
+func ObtainNegotiationResult(body []byte, opts ...Option) (*NegotiationResult, error) {
+	remoteSDP, err := unmarshalSDP(body)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshaling SDP: %w", err)
+	}
+
+	if len(remoteSDP.MediaDescriptions) == 0 {
+		return nil, fmt.Errorf("no media descriptions in SDP")
+	}
+
+	cfg := newConfig(opts)
+	cfg.logger.Debug("obtaining negotiation result",
+		"origin", remoteSDP.Origin.UnicastAddress,
+		"media", len(remoteSDP.MediaDescriptions),
+	)
+
+	streams, err := obtainStreams(remoteSDP, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(streams) == 0 {
+		return nil, fmt.Errorf("no supported formats in media description")
+	}
+
+	return newNegotiationResult(streams, nil, body), nil
+}
+
+func answerOffer(req *sip.Request, connSIP UDPConn, cfg *config, conns streamConns) (*sip.Response, *NegotiationResult, error) {
+	body := req.Body()
+	if len(body) == 0 {
+		return nil, nil, fmt.Errorf("no SDP in the request")
+	}
+
+	remoteSDP, err := unmarshalSDP(body)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	localSDP, streams, err := negotiateLocalSDP(remoteSDP, cfg, connSIP, conns)
+	if err != nil {
+		return nil, nil, fmt.Errorf("negotiating SDP: %w", err)
+	}
+
+	resp, err := createSDPResponse(localSDP, req, connSIP, cfg)
+	if err != nil {
+		return nil, nil, fmt.Errorf("creating SDP response: %w", err)
+	}
+
+	results := []StreamResult{}
+
+	for _, stream := range streams {
+		results = append(results, answeredStream(remoteSDP, stream, cfg))
+	}
+
+	return resp, newNegotiationResult(results, resp.Body(), body), nil
+}
@@ -0,0 +1,105 @@
+package sdp
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+
+	"github.com/emiago/sipgo/sip"
+)
+
+const (
+	lrParam        = "lr"
+	defaultSIPPort = 5060
+	defaultTLSPort = 5061
+)
+
+// recordRouteSet returns the URIs of the Record-Route headers of msg, in order.
+func recordRouteSet(msg sip.Message) []sip.Uri {
+	routeSet := []sip.Uri{}
+
+	for _, h := range msg.GetHeaders("Record-Route") {
+		if recordRoute, ok := h.(*sip.RecordRouteHeader); ok {
+			routeSet = append(routeSet, *recordRoute.Address.Clone())
+		}
+	}
+
+	return routeSet
+}
+
+// uacRouteSet returns the route set a UAC learns from the Record-Route of a
+// response, which lists the proxies from the UAS side first.
+func uacRouteSet(resp *sip.Response) []sip.Uri {
+	routeSet := recordRouteSet(resp)
+	slices.Reverse(routeSet)
+
+	return routeSet
+}
+
+// routeRequest sets the Request-URI and Route headers of req as described in
+// RFC 3261 section 12.2.1.1. When the first hop is a strict router, it
+// becomes the Request-URI and the remote target is appended as last Route.
+func routeRequest(req *sip.Request, routeSet []sip.Uri, remoteTarget sip.Uri) {
+	req.Recipient = *remoteTarget.Clone()
+
+	if len(routeSet) == 0 {
+		return
+	}
+
+	routes := routeSet
+	if !isLooseRouter(routeSet[0]) {
+		req.Recipient = *routeSet[0].Clone()
+		routes = append(slices.Clone(routeSet[1:]), remoteTarget)
+	}
+
+	for _, uri := range routes {
+		req.AppendHeader(&sip.RouteHeader{Address: *uri.Clone()})
+	}
+}
+
+func isLooseRouter(uri sip.Uri) bool {
+	return uri.UriParams.Has(lrParam)
+}
+
+// NextHop returns the address req must be sent to: the first Route when it
+// is a loose router, the Request-URI otherwise, as described in RFC 3261
+// section 8.1.2. A request routed through a strict router cannot always be
+// told apart by its headers; Dialog.NextHop handles it for in-dialog
+// requests.
+func NextHop(req *sip.Request) (*net.UDPAddr, error) {
+	if route := req.Route(); route != nil && isLooseRouter(route.Address) {
+		return resolveURI(route.Address)
+	}
+
+	return resolveURI(req.Recipient)
+}
+
+// resolveURI looks up the host, or maddr, of uri with A and AAAA records
+// only, using the default port of its scheme.
+func resolveURI(uri sip.Uri) (*net.UDPAddr, error) {
+	port := uri.Port
+	if port == 0 {
+		port = defaultSIPPort
+		if uri.IsEncrypted() {
+			port = defaultTLSPort
+		}
+	}
+
+	host := uri.Host
+	if maddr, ok := uri.UriParams.Get("maddr"); ok && maddr != "" {
+		host = maddr
+	}
+
+	if ip := net.ParseIP(host); ip != nil {
+		return &net.UDPAddr{IP: ip, Port: port}, nil
+	}
+
+	ips, err := net.DefaultResolver.LookupIP(context.Background(), "ip", host)
+	if err != nil {
+		return nil, fmt.Errorf("resolving next hop %s: %w", net.JoinHostPort(host, strconv.Itoa(port)), err)
+	}
+
+	return &net.UDPAddr{IP: ips[0], Port: port}, nil
+}
@@ -0,0 +1,130 @@
+package sdp
+
+import (
+	"net"
+	"slices"
+	"testing"
+
+	"github.com/emiago/sipgo/sip"
+)
+
+func TestDialogRouteSet(t *testing.T) {
+	localSIPAddr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 5070}
+
+	// p2 is next to bob and p1 next to alice.
+	invite, resp := testDialogPair(t, "sip:192.0.2.12;lr", "sip:192.0.2.11;lr")
+
+	uac, err := NewDialogUAC(invite, resp, localSIPAddr)
+	if err != nil {
+		t.Fatalf("NewDialogUAC: %v", err)
+	}
+
+	uas, err := NewDialogUAS(invite, resp, localSIPAddr)
+	if err != nil {
+		t.Fatalf("NewDialogUAS: %v", err)
+	}
+
+	// p1 is a strict router, which a BYE cannot tell apart by its headers.
+	invite, resp = testDialogPair(t, "sip:192.0.2.12;lr", "sip:192.0.2.11:5080")
+
+	strict, err := NewDialogUAC(invite, resp, localSIPAddr)
+	if err != nil {
+		t.Fatalf("NewDialogUAC: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		dialog   *Dialog
+		routes   []string
+		target   string
+		nextHop  string
+		isStrict bool
+	}{
+		{name: "UAC", dialog: uac, routes: []string{"<sip:192.0.2.11;lr>", "<sip:192.0.2.12;lr>"}, target: "sip:bob@192.0.2.2:5060", nextHop: "192.0.2.11:5060"},
+		{name: "UAS", dialog: uas, routes: []string{"<sip:192.0.2.12;lr>", "<sip:192.0.2.11;lr>"}, target: "sip:alice@192.0.2.1:5070", nextHop: "192.0.2.12:5060"},
+		{name: "UAC through a strict router", dialog: strict, routes: []string{"<sip:192.0.2.12;lr>", "<sip:bob@192.0.2.2:5060>"}, target: "sip:192.0.2.11:5080", nextHop: "192.0.2.11:5080", isStrict: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bye := tt.dialog.CreateBYE()
+			if routes := routeValues(bye); !slices.Equal(routes, tt.routes) {
+				t.Fatalf("Route = %v, want %v", routes, tt.routes)
+			}
+
+			if bye.Recipient.String() != tt.target {
+				t.Fatalf("Request-URI = %s, want %s", bye.Recipient.String(), tt.target)
+			}
+
+			nextHop, err := tt.dialog.NextHop()
+			if err != nil || nextHop.String() != tt.nextHop {
+				t.Fatalf("NextHop() = %v, %v, want %s", nextHop, err, tt.nextHop)
+			}
+
+			if tt.isStrict {
+				return
+			}
+
+			if nextHop, err := NextHop(bye); err != nil || nextHop.String() != tt.nextHop {
+				t.Fatalf("NextHop(BYE) = %v, %v, want %s", nextHop, err, tt.nextHop)
+			}
+		})
+	}
+}
+
+func TestRouteRequest(t *testing.T) {
+	remoteTarget := "sip:bob@192.0.2.2:5060"
+
+	tests := []struct {
+		name      string
+		routeSet  []string
+		recipient string
+		routes    []string
+		nextHop   string
+	}{
+		{
+			name:      "no route set",
+			recipient: remoteTarget,
+			routes:    []string{},
+			nextHop:   "192.0.2.2:5060",
+		},
+		{
+			name:      "loose router",
+			routeSet:  []string{"sip:192.0.2.11;lr", "sip:192.0.2.12;lr"},
+			recipient: remoteTarget,
+			routes:    []string{"<sip:192.0.2.11;lr>", "<sip:192.0.2.12;lr>"},
+			nextHop:   "192.0.2.11:5060",
+		},
+		{
+			name:      "strict router",
+			routeSet:  []string{"sip:192.0.2.11:5080", "sip:192.0.2.12"},
+			recipient: "sip:192.0.2.11:5080",
+			routes:    []string{"<sip:192.0.2.12>", "<" + remoteTarget + ">"},
+			nextHop:   "192.0.2.11:5080",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			routeSet := []sip.Uri{}
+			for _, uri := range tt.routeSet {
+				routeSet = append(routeSet, testURI(t, uri))
+			}
+
+			req := sip.NewRequest(sip.BYE, sip.Uri{})
+			routeRequest(req, routeSet, testURI(t, remoteTarget))
+
+			if req.Recipient.String() != tt.recipient {
+				t.Fatalf("Request-URI = %s, want %s", req.Recipient.String(), tt.recipient)
+			}
+
+			if routes := routeValues(req); !slices.Equal(routes, tt.routes) {
+				t.Fatalf("Route = %v, want %v", routes, tt.routes)
+			}
+
+			if nextHop, err := NextHop(req); err != nil || nextHop.String() != tt.nextHop {
+				t.Fatalf("NextHop() = %v, %v, want %s", nextHop, err, tt.nextHop)
+			}
+		})
+	}
+}
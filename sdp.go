@@ -1,9 +1,11 @@
 package sdp
 
 import (
+	"errors"
 	"fmt"
-	"math/rand"
 	"net"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/emiago/sipgo/sip"
@@ -11,171 +13,165 @@ import (
 )
 
 const (
-	UserAgent    = "Andres/0.1"
-	defFrameDur  = time.Duration(20 * time.Millisecond) // 20ms
-	rtcpHeader   = "rtcp"
-	ptimeHeader  = "ptime"
-	ptimeDefault = int(defFrameDur / time.Millisecond)
+	UserAgent      = "Andres/0.1"
+	defFrameDur    = time.Duration(20 * time.Millisecond) // 20ms
+	rtcpHeader     = "rtcp"
+	rtcpMuxHeader  = "rtcp-mux"
+	ptimeHeader    = "ptime"
+	maxptimeHeader = "maxptime"
+	ptimeDefault   = int(defFrameDur / time.Millisecond)
 )
 
-func createContactHeader(connSIP UDPConn) *sip.ContactHeader {
+func createContactHeader(connSIP UDPConn, cfg *config) *sip.ContactHeader {
+	localSIPAddr := cfg.advertisedAddr(connSIP.LocalAddr().(*net.UDPAddr))
+
 	contact := &sip.ContactHeader{}
-	contact.Address.Host = connSIP.LocalAddr().(*net.UDPAddr).IP.String()
-	contact.Address.Port = connSIP.LocalAddr().(*net.UDPAddr).Port
+	contact.Address.Host = localSIPAddr.IP.String()
+	contact.Address.Port = localSIPAddr.Port
 	contact.Address.User = "andres-proxy"
 
 	return contact
 }
 
-var (
-	availableCodecs = map[string]sdp.Attribute{
-		"0": {
-			Key:   "rtpmap",
-			Value: "0 PCMU/8000",
-		},
-		"8": {
-			Key:   "rtpmap",
-			Value: "8 PCMA/8000",
-		},
-		"9": {
-			Key:   "rtpmap",
-			Value: "9 G722/8000",
-		},
-		"96": {
-			Key:   "rtpmap",
-			Value: "96 opus/48000/2",
-		},
-		"105": {
-			Key:   "rtpmap",
-			Value: "105 opus/48000/2",
-		},
-		"106": {
-			Key:   "rtpmap",
-			Value: "106 opus/48000/2",
-		},
-	}
-	ConfigCodecs = map[string]struct {
-		SamplingRate int
-		Channels     int
-		PayloadType  byte
-	}{
-		"0":   {8000, 1, 0},
-		"8":   {8000, 1, 8},
-		"9":   {8000, 1, 9}, // TODO: G722 - not ready. Bad audio from LK to SIP
-		"96":  {48000, 1, 96},
-		"105": {48000, 1, 105},
-		"106": {48000, 1, 106},
+func createConnRTP(connSIP UDPConn, port int) (*net.UDPConn, error) {
+	laddrSIP, ok := connSIP.LocalAddr().(*net.UDPAddr)
+	if !ok {
+		return nil, &SocketError{Socket: "RTP", Err: ErrNotUDP}
 	}
-)
 
-func createConnRTP(connSIP UDPConn) (*net.UDPConn, error) {
 	laddrRTP := &net.UDPAddr{
-		IP:   connSIP.LocalAddr().(*net.UDPAddr).IP,
-		Port: 0,
-		Zone: connSIP.LocalAddr().(*net.UDPAddr).Zone,
+		IP:   laddrSIP.IP,
+		Port: port,
+		Zone: laddrSIP.Zone,
 	}
 
 	connRTP, err := net.ListenUDP("udp", laddrRTP)
 	if err != nil {
-		return nil, fmt.Errorf("cannot start RTP listener: %w", err)
+		return nil, &SocketError{Socket: "RTP", Addr: laddrRTP, Err: err}
 	}
 
 	return connRTP, nil
 }
 
 func createConnRTCP(connSIP, connRTP UDPConn) (*net.UDPConn, error) {
-	laddrRTPport := connRTP.LocalAddr().(*net.UDPAddr).Port + 1
+	laddrSIP, okSIP := connSIP.LocalAddr().(*net.UDPAddr)
+	laddrRTP, okRTP := connRTP.LocalAddr().(*net.UDPAddr)
+
+	if !okSIP || !okRTP {
+		return nil, &SocketError{Socket: "RTCP", Err: ErrNotUDP}
+	}
+
 	laddrRTCP := &net.UDPAddr{
-		IP:   connSIP.LocalAddr().(*net.UDPAddr).IP,
-		Port: laddrRTPport,
-		Zone: connSIP.LocalAddr().(*net.UDPAddr).Zone,
+		IP:   laddrSIP.IP,
+		Port: laddrRTP.Port + 1,
+		Zone: laddrSIP.Zone,
 	}
 
 	connRTCP, err := net.ListenUDP("udp", laddrRTCP)
 	if err != nil {
-		return nil, fmt.Errorf("cannot start RTP listener: %w", err)
+		return nil, &SocketError{Socket: "RTCP", Addr: laddrRTCP, Err: err}
 	}
 
 	return connRTCP, nil
 }
 
-func generateNewRTPAndRTCP(connSIP UDPConn) (*net.UDPConn, *net.UDPConn, error) {
-	connRTP, err := createConnRTP(connSIP)
+func generateNewRTPAndRTCP(connSIP UDPConn, cfg *config) (*net.UDPConn, *net.UDPConn, error) {
+	connRTP, connRTCP, err := cfg.ports.Allocate(connSIP)
 	if err != nil {
-		return nil, nil, fmt.Errorf("creating RTP connection: %w", err)
+		return nil, nil, fmt.Errorf("allocating RTP and RTCP ports: %w", err)
 	}
 
-	connRTCP, err := createConnRTCP(connSIP, connRTP)
+	cfg.discoverMappings(connRTP, connRTCP)
+
+	cfg.logger.Debug("allocated RTP and RTCP connections",
+		"rtp", connRTP.LocalAddr(),
+		"rtcp", connRTCP.LocalAddr(),
+	)
+
+	return connRTP, connRTCP, nil
+}
+
+func generateNewRTP(connSIP UDPConn, cfg *config) (*net.UDPConn, error) {
+	connRTP, err := cfg.ports.AllocateRTP(connSIP)
 	if err != nil {
-		return nil, nil, fmt.Errorf("creating RTCP connection: %w", err)
+		return nil, fmt.Errorf("allocating RTP port: %w", err)
 	}
 
-	return connRTP, connRTCP, nil
+	cfg.discoverMapping(connRTP)
+
+	cfg.logger.Debug("allocated RTP connection", "rtp", connRTP.LocalAddr(), "rtcp_mux", true)
+
+	return connRTP, nil
 }
 
-func createSDPResponse(localSDP *sdp.SessionDescription, req *sip.Request, connSIP UDPConn) (*sip.Response, error) {
+func createSDPResponse(localSDP *sdp.SessionDescription, req *sip.Request, connSIP UDPConn, cfg *config) (*sip.Response, error) {
 	data, err := localSDP.Marshal()
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal local SDP: %v", err)
 	}
 
 	sdpResp := sip.NewSDPResponseFromRequest(req, data)
-	sdpResp.AppendHeader(createContactHeader(connSIP))
+	sdpResp.AppendHeader(createContactHeader(connSIP, cfg))
 
 	return sdpResp, nil
 }
 
-func generateLocalSDP(connSIP *net.UDPConn, rtpHost string) ([]byte, *net.UDPConn, *net.UDPConn, error) {
+// generateLocalSDP allocates connections on rtpHost for every offered media
+// and creates the offer. An empty or unspecified rtpHost binds every interface
+// and needs an advertised address, since the offer cannot carry it. The
+// connections are closed if it fails.
+func generateLocalSDP(connSIP *net.UDPConn, rtpHost string, cfg *config) ([]byte, []StreamResult, error) {
 	rtpAddr := net.ParseIP(rtpHost)
-	temporaryConnRTP, err := net.ListenUDP("udp", &net.UDPAddr{IP: rtpAddr})
-	if err != nil {
-		panic(err)
+	if rtpAddr == nil && rtpHost != "" {
+		return nil, nil, fmt.Errorf("%w: %q", ErrInvalidRTPHost, rtpHost)
 	}
 
-	defer temporaryConnRTP.Close()
+	if _, ok := cfg.advertised[""]; (rtpAddr == nil || rtpAddr.IsUnspecified()) && !ok {
+		return nil, nil, fmt.Errorf("%w: %q is unspecified and no address is advertised", ErrInvalidRTPHost, rtpHost)
+	}
+
+	laddr := &net.UDPAddr{IP: rtpAddr}
 
-	connRTP, connRTCP, err := generateNewRTPAndRTCP(temporaryConnRTP)
+	temporaryConnRTP, err := net.ListenUDP("udp", laddr)
 	if err != nil {
-		return nil, nil, nil, fmt.Errorf("generating RTP and RTCP connections: %w", err)
-	}
-
-	ownSDP := &sdp.SessionDescription{
-		MediaDescriptions: []*sdp.MediaDescription{
-			{
-				MediaName: sdp.MediaName{
-					Media: "audio",
-					Formats: []string{
-						"106", "105", "96", "8", "0",
-					},
-				},
-			},
-		},
+		return nil, nil, &SocketError{Socket: "temporary RTP", Addr: laddr, Err: err}
 	}
 
-	sdp, _ := negotiateLocalSDP(ownSDP, connSIP, connRTP, connRTCP)
+	defer temporaryConnRTP.Close()
+
+	conns := map[string]mediaConns{}
+	streams := []StreamResult{}
+
+	for i, media := range cfg.offeredMedia() {
+		connRTP, connRTCP, err := generateNewRTPAndRTCP(temporaryConnRTP, cfg)
+		if err != nil {
+			return nil, nil, errors.Join(fmt.Errorf("generating RTP and RTCP connections: %w", err), closeStreams(streams))
+		}
+
+		conns[media] = mediaConns{connRTP: connRTP, connRTCP: connRTCP}
+		streams = append(streams, StreamResult{
+			Index:    i,
+			Media:    media,
+			LocalICE: cfg.ice,
+			ConnRTP:  connRTP,
+			ConnRTCP: connRTCP,
+		})
+	}
 
-	data, err := sdp.Marshal()
+	data, err := newSession(cfg, connSIP, conns).CreateOffer()
 	if err != nil {
-		return nil, nil, nil, fmt.Errorf("marshaling local SDP: %w", err)
+		return nil, nil, errors.Join(fmt.Errorf("creating local offer: %w", err), closeStreams(streams))
 	}
 
-	return data, connRTP, connRTCP, nil
+	return data, streams, nil
 }
 
-func negotiateLocalSDP(
-	remoteSDP *sdp.SessionDescription,
-	_ UDPConn,
-	connRTP UDPConn,
-	connRTCP UDPConn,
-) (*sdp.SessionDescription, string) {
-	// connSIPLocalAddr := connSIP.LocalAddr().(*net.UDPAddr)
-	connRTPLocalAddr := connRTP.LocalAddr().(*net.UDPAddr)
-	connRTCPLocalAddr := connRTCP.LocalAddr().(*net.UDPAddr)
+func newLocalSessionDescription(cfg *config, connRTP UDPConn) *sdp.SessionDescription {
+	connRTPLocalAddr := cfg.advertisedAddr(connRTP.LocalAddr().(*net.UDPAddr))
 
 	localSDP := &sdp.SessionDescription{}
 	localSDP.Origin.Username = "-"
-	localSDP.Origin.SessionID = uint64(rand.Uint32())
-	localSDP.Origin.SessionVersion = uint64(rand.Uint32())
+	localSDP.Origin.SessionID, localSDP.Origin.SessionVersion = cfg.ports.nextOrigin(connRTP.LocalAddr().(*net.UDPAddr))
 	localSDP.Origin.UnicastAddress = connRTPLocalAddr.IP.String()
 	localSDP.Origin.AddressType = obtainAdressType(connRTPLocalAddr.IP)
 	localSDP.Origin.NetworkType = "IN"
@@ -189,58 +185,415 @@ func negotiateLocalSDP(
 		},
 	}
 
-	selectedFormat := ""
+	localSDP.ConnectionInformation = &sdp.ConnectionInformation{
+		NetworkType: "IN",
+		AddressType: obtainAdressType(connRTPLocalAddr.IP),
+		Address:     &sdp.Address{Address: connRTPLocalAddr.IP.String()},
+	}
+
+	return localSDP
+}
+
+func newLocalMediaDescription(cfg *config, stream negotiatedStream) *sdp.MediaDescription {
+	connRTPLocalAddr := cfg.advertisedAddr(stream.connRTP.LocalAddr().(*net.UDPAddr))
+
 	formats := []string{}
 	mediaAttributes := []sdp.Attribute{}
 
-	if len(remoteSDP.MediaDescriptions) > 0 {
-		for _, format := range remoteSDP.MediaDescriptions[0].MediaName.Formats {
-			if attr, ok := availableCodecs[format]; ok {
-				formats = append(formats, format)
-				mediaAttributes = append(mediaAttributes, attr)
-			}
+	for _, codec := range stream.codecs {
+		formats = append(formats, codec.Format())
+		mediaAttributes = append(mediaAttributes, codec.Rtpmap())
+		if fmtp, ok := codec.FmtpAttribute(); ok {
+			mediaAttributes = append(mediaAttributes, fmtp)
+		}
+
+		mediaAttributes = append(mediaAttributes, codec.RTCPFeedbackAttributes()...)
+	}
+
+	if stream.media == mediaAudio {
+		mediaAttributes = append(mediaAttributes, ptimeAttributes(stream.codecs[0], stream.ptime, stream.maxptime)...)
+	}
+
+	mediaAttributes = append(mediaAttributes, stream.direction.attribute())
+
+	if stream.rtcpMux {
+		mediaAttributes = append(mediaAttributes, sdp.Attribute{Key: rtcpMuxHeader})
+	}
+
+	if stream.ice {
+		mediaAttributes = append(mediaAttributes, cfg.iceAttributes(stream)...)
+	}
+
+	proto := protoRTPAVP
+	for _, crypto := range stream.cryptos {
+		proto = protoRTPSAVP
+		mediaAttributes = append(mediaAttributes, crypto.attribute())
+	}
+
+	if stream.setup != "" {
+		proto = protoDTLS
+		mediaAttributes = append(mediaAttributes, cfg.dtlsAttributes(stream.setup)...)
+	}
+
+	if stream.connRTCP != nil {
+		connRTCPLocalAddr := cfg.advertisedAddr(stream.connRTCP.LocalAddr().(*net.UDPAddr))
+		mediaAttributes = append(mediaAttributes, sdp.Attribute{
+			Key:   rtcpHeader,
+			Value: fmt.Sprintf("%d IN %s %s", connRTCPLocalAddr.Port, obtainAdressType(connRTCPLocalAddr.IP), connRTCPLocalAddr.IP.String()),
+		})
+	}
+
+	return &sdp.MediaDescription{
+		MediaName: sdp.MediaName{
+			Media:   stream.media,
+			Port:    sdp.RangedPort{Value: connRTPLocalAddr.Port},
+			Protos:  strings.Split(proto, "/"),
+			Formats: formats,
+		},
+		Attributes: mediaAttributes,
+	}
+}
+
+// hasRTCPMux reports whether the m= line asks for RTCP on the RTP port, as
+// described in RFC 5761.
+func hasRTCPMux(md *sdp.MediaDescription) bool {
+	_, ok := md.Attribute(rtcpMuxHeader)
+
+	return ok
+}
+
+// offerLocalSDP offers one m= line per kind of media, skipping the ones
+// for which conns gives nothing. Unless disabled, rtcp-mux is offered along
+// with the RTCP port to fall back to, or alone if there is no RTCP connection.
+func offerLocalSDP(cfg *config, conns streamConns) (*sdp.SessionDescription, error) {
+	if cfg.err != nil {
+		return nil, cfg.err
+	}
+
+	var firstConnRTP UDPConn
+
+	mediaDescriptions := []*sdp.MediaDescription{}
+
+	for _, media := range cfg.offeredMedia() {
+		connRTP, connRTCP, err := conns(len(mediaDescriptions), media, !cfg.noRTCPMux)
+		if err != nil {
+			return nil, fmt.Errorf("obtaining connections for %s: %w", media, err)
+		}
+
+		if connRTP == nil || (connRTCP == nil && cfg.noRTCPMux) {
+			continue
 		}
-		if len(formats) > 0 {
-			selectedFormat = formats[0]
+
+		if firstConnRTP == nil {
+			firstConnRTP = connRTP
 		}
+
+		var (
+			cryptos []CryptoAttribute
+			setup   SetupRole
+		)
+
+		if cfg.dtlsCert != nil {
+			setup = SetupActpass
+		} else if cryptos, err = cfg.offerCryptos(); err != nil {
+			return nil, fmt.Errorf("generating crypto for %s: %w", media, err)
+		}
+
+		codecs := cfg.codecs.MediaCodecs(media)
+		maxptime := offeredMaxptime(codecs)
+		mediaDescriptions = append(mediaDescriptions, newLocalMediaDescription(cfg, negotiatedStream{
+			index:     len(mediaDescriptions),
+			media:     media,
+			codecs:    codecs,
+			direction: cfg.direction,
+			ptime:     agreedPtime(codecs[0], 0, maxptime),
+			maxptime:  maxptime,
+			rtcpMux:   !cfg.noRTCPMux,
+			ice:       cfg.ice != nil,
+			cryptos:   cryptos,
+			setup:     setup,
+			connRTP:   connRTP,
+			connRTCP:  connRTCP,
+		}))
 	}
 
-	localSDP.ConnectionInformation = &sdp.ConnectionInformation{
-		NetworkType: "IN",
-		AddressType: obtainAdressType(connRTPLocalAddr.IP),
-		Address:     &sdp.Address{Address: connRTPLocalAddr.IP.String()},
+	if firstConnRTP == nil {
+		return nil, fmt.Errorf("no media to offer")
 	}
 
-	localSDP.MediaDescriptions = []*sdp.MediaDescription{
-		{
-			MediaName: sdp.MediaName{
-				Media:   "audio",
-				Port:    sdp.RangedPort{Value: connRTPLocalAddr.Port},
-				Protos:  []string{"RTP", "AVP"},
-				Formats: formats,
-			},
-			Attributes: append(mediaAttributes, []sdp.Attribute{
-				{
-					Key:   ptimeHeader,
-					Value: fmt.Sprint(ptimeDefault),
-				},
-				{
-					Key:   "minptime",
-					Value: "10",
-				},
-				{
-					Key:   "sendrecv",
-					Value: "",
-				},
-				{
-					Key:   "rtcp",
-					Value: fmt.Sprintf("%d IN %s %s", connRTCPLocalAddr.Port, obtainAdressType(connRTCPLocalAddr.IP), connRTCPLocalAddr.IP.String()),
-				},
-			}...),
+	localSDP := newLocalSessionDescription(cfg, firstConnRTP)
+	localSDP.MediaDescriptions = mediaDescriptions
+
+	cfg.logger.Debug("created local offer",
+		"media", len(mediaDescriptions),
+		"rtcp_mux", !cfg.noRTCPMux,
+		"ice", cfg.ice != nil,
+		"dtls", cfg.dtlsCert != nil,
+		"srtp_suites", cfg.srtpSuites,
+	)
+
+	if cfg.ice != nil {
+		localSDP.Attributes = append(localSDP.Attributes, sdp.Attribute{Key: iceLiteHeader})
+	}
+
+	return localSDP, nil
+}
+
+// negotiatedStream is an m= line of a local offer or an accepted one of a
+// local answer.
+type negotiatedStream struct {
+	index     int
+	media     string
+	codecs    []Codec
+	direction Direction
+	ptime     int // audio only
+	maxptime  int // audio only, 0 if no limit
+	rtcpMux   bool
+	ice       bool
+	cryptos   []CryptoAttribute // local a=crypto lines, none for RTP/AVP
+	srtp      *SRTPKeys         // agreed in an answer, nil otherwise
+	setup     SetupRole         // local a=setup, "" unless DTLS-SRTP is used
+	dtls      *DTLSParameters   // agreed in an answer, nil otherwise
+	connRTP   UDPConn
+	connRTCP  UDPConn // nil when answering with RTCP multiplexed on RTP
+
+	remoteRTP  *net.UDPAddr // resolved in an answer, nil otherwise
+	remoteRTCP *net.UDPAddr
+}
+
+// streamConns returns the local connections for the m= line at index, or
+// nil ones to reject it. With rtcpMux the RTCP connection is optional.
+type streamConns func(index int, media string, rtcpMux bool) (UDPConn, UDPConn, error)
+
+// mediaConns are the local connections of one stream.
+type mediaConns struct {
+	connRTP  UDPConn
+	connRTCP UDPConn
+}
+
+// perMediaConns hands out the connections of each kind of media to the
+// first m= line of that kind only.
+func perMediaConns(conns map[string]mediaConns) streamConns {
+	used := map[string]bool{}
+
+	return func(_ int, media string, _ bool) (UDPConn, UDPConn, error) {
+		pair, ok := conns[media]
+		if !ok || used[media] {
+			return nil, nil, nil
+		}
+
+		used[media] = true
+
+		return pair.connRTP, pair.connRTCP, nil
+	}
+}
+
+// singleStreamConns hands out the given connections to the first accepted
+// audio m= line only.
+func singleStreamConns(connRTP, connRTCP UDPConn) streamConns {
+	return perMediaConns(map[string]mediaConns{
+		mediaAudio: {connRTP: connRTP, connRTCP: connRTCP},
+	})
+}
+
+// isSupportedMedia reports whether the m= line is audio or video over
+// RTP/AVP, RTP/SAVP when SDES is enabled or UDP/TLS/RTP/SAVPF when DTLS is.
+func isSupportedMedia(cfg *config, md *sdp.MediaDescription) bool {
+	proto := mediaProto(md)
+
+	return (md.MediaName.Media == mediaAudio || md.MediaName.Media == mediaVideo) &&
+		md.MediaName.Port.Value != 0 &&
+		(proto == protoRTPAVP ||
+			(proto == protoRTPSAVP && len(cfg.srtpSuites) > 0) ||
+			(proto == protoDTLS && cfg.dtlsCert != nil))
+}
+
+// rejectedMediaDescription answers an m= line with port 0 as described in
+// RFC 3264 section 6.
+func rejectedMediaDescription(remoteMedia *sdp.MediaDescription) *sdp.MediaDescription {
+	return &sdp.MediaDescription{
+		MediaName: sdp.MediaName{
+			Media:   remoteMedia.MediaName.Media,
+			Port:    sdp.RangedPort{Value: 0},
+			Protos:  remoteMedia.MediaName.Protos,
+			Formats: remoteMedia.MediaName.Formats,
 		},
 	}
+}
+
+// negotiateLocalSDP answers every m= line of the remote offer, in order,
+// rejecting the ones that are unsupported or for which conns gives nothing.
+func negotiateLocalSDP(
+	remoteSDP *sdp.SessionDescription,
+	cfg *config,
+	connSIP UDPConn,
+	conns streamConns,
+) (*sdp.SessionDescription, []negotiatedStream, error) {
+	if cfg.err != nil {
+		return nil, nil, cfg.err
+	}
+
+	streams := []negotiatedStream{}
+	mediaDescriptions := []*sdp.MediaDescription{}
+
+	for i, remoteMedia := range remoteSDP.MediaDescriptions {
+		codecs := []Codec{}
+		if isSupportedMedia(cfg, remoteMedia) {
+			codecs = negotiateCodecs(cfg.codecs, remoteMedia)
+		}
+
+		reason := ""
+		if len(codecs) == 0 {
+			reason = "no common codec"
+		}
+
+		var (
+			cryptos    []CryptoAttribute
+			keys       *SRTPKeys
+			setup      SetupRole
+			dtlsParams *DTLSParameters
+		)
+
+		if len(codecs) > 0 && mediaProto(remoteMedia) == protoRTPSAVP {
+			local, remote, ok, err := cfg.answerCrypto(remoteMedia)
+			if err != nil {
+				return nil, nil, fmt.Errorf("answering crypto of m= line %d: %w", i, err)
+			}
+
+			if ok {
+				cryptos = []CryptoAttribute{local}
+				keys = newSRTPKeys(local, remote)
+			} else {
+				codecs = nil
+				reason = "no common SRTP crypto suite"
+			}
+		}
+
+		if len(codecs) > 0 && mediaProto(remoteMedia) == protoDTLS {
+			role, ok := answerSetup(parseSetup(remoteSDP, remoteMedia, true))
+			fingerprints := parseFingerprints(remoteSDP, remoteMedia)
+
+			if ok && len(fingerprints) > 0 {
+				setup = role
+				dtlsParams = &DTLSParameters{
+					Role:               role,
+					Certificate:        *cfg.dtlsCert,
+					RemoteFingerprints: fingerprints,
+				}
+			} else {
+				codecs = nil
+				reason = "no usable DTLS setup or fingerprint"
+			}
+		}
+
+		rtcpMux := !cfg.noRTCPMux && hasRTCPMux(remoteMedia)
+
+		var remoteRTP, remoteRTCP *net.UDPAddr
+
+		if len(codecs) > 0 {
+			var err error
+			if remoteRTP, remoteRTCP, err = resolveRemoteTransport(remoteSDP, remoteMedia, rtcpMux); err != nil {
+				codecs = nil
+				reason = "unusable remote transport: " + err.Error()
+			}
+		}
+
+		if len(codecs) == 0 {
+			cfg.logger.Debug("rejecting m= line",
+				"index", i,
+				"media", remoteMedia.MediaName.Media,
+				"proto", mediaProto(remoteMedia),
+				"reason", reason,
+			)
+
+			mediaDescriptions = append(mediaDescriptions, rejectedMediaDescription(remoteMedia))
+
+			continue
+		}
+
+		connRTP, connRTCP, err := conns(i, remoteMedia.MediaName.Media, rtcpMux)
+		if err != nil {
+			return nil, nil, fmt.Errorf("obtaining connections for m= line %d: %w", i, err)
+		}
+
+		if rtcpMux && connRTCP != nil {
+			// RTCP shares the RTP port from now on, as RFC 5761 describes.
+			if err := connRTCP.Close(); err != nil {
+				return nil, nil, fmt.Errorf("closing RTCP connection of m= line %d: %w", i, err)
+			}
+
+			connRTCP = nil
+		}
+
+		if connRTP == nil || (connRTCP == nil && !rtcpMux) {
+			cfg.logger.Debug("rejecting m= line",
+				"index", i,
+				"media", remoteMedia.MediaName.Media,
+				"reason", "no local connection for the stream",
+			)
+
+			mediaDescriptions = append(mediaDescriptions, rejectedMediaDescription(remoteMedia))
+
+			continue
+		}
+
+		remotePtime, remoteMaxptime := parsePtimes(remoteMedia)
+		stream := negotiatedStream{
+			index:      i,
+			media:      remoteMedia.MediaName.Media,
+			codecs:     codecs,
+			direction:  parseDirection(remoteSDP, remoteMedia).answer(cfg.direction),
+			ptime:      agreedPtime(codecs[0], remotePtime, remoteMaxptime),
+			maxptime:   agreedMaxptime(codecs[0], remoteMaxptime),
+			rtcpMux:    rtcpMux,
+			ice:        cfg.ice != nil && hasICE(remoteSDP, remoteMedia),
+			cryptos:    cryptos,
+			srtp:       keys,
+			setup:      setup,
+			dtls:       dtlsParams,
+			connRTP:    connRTP,
+			connRTCP:   connRTCP,
+			remoteRTP:  remoteRTP,
+			remoteRTCP: remoteRTCP,
+		}
+
+		cfg.logger.Debug("accepting m= line",
+			"index", i,
+			"media", stream.media,
+			"codec", codecs[0].Format(),
+			"ptime", stream.ptime,
+			"direction", stream.direction,
+			"rtcp_mux", rtcpMux,
+			"ice", stream.ice,
+			"srtp", keys != nil,
+			"dtls", dtlsParams != nil,
+		)
+
+		streams = append(streams, stream)
+		mediaDescriptions = append(mediaDescriptions, newLocalMediaDescription(cfg, stream))
+	}
+
+	localSDP := newLocalSessionDescription(cfg, connSIP)
+	if len(streams) > 0 {
+		localSDP = newLocalSessionDescription(cfg, streams[0].connRTP)
+	}
+
+	localSDP.MediaDescriptions = mediaDescriptions
+
+	if slices.ContainsFunc(streams, func(stream negotiatedStream) bool { return stream.ice }) {
+		localSDP.Attributes = append(localSDP.Attributes, sdp.Attribute{Key: iceLiteHeader})
+	}
+
+	return localSDP, streams, nil
+}
+
+// selectedFormat returns the preferred format of the first accepted stream.
+func selectedFormat(streams []negotiatedStream) string {
+	if len(streams) == 0 {
+		return ""
+	}
 
-	return localSDP, selectedFormat
+	return streams[0].codecs[0].Format()
 }
 
 func unmarshalSDP(data []byte) (*sdp.SessionDescription, error) {
@@ -0,0 +1,401 @@
+package sdp
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/emiago/sipgo/sip"
+	"github.com/pion/sdp/v4"
+)
+
+// SignalingState is the offer/answer state of a Session as described in RFC 3264.
+type SignalingState int
+
+const (
+	StateStable SignalingState = iota
+	StateHaveLocalOffer
+	StateHaveRemoteOffer
+)
+
+func (s SignalingState) String() string {
+	switch s {
+	case StateStable:
+		return "stable"
+	case StateHaveLocalOffer:
+		return "have-local-offer"
+	case StateHaveRemoteOffer:
+		return "have-remote-offer"
+	}
+
+	return fmt.Sprintf("SignalingState(%d)", int(s))
+}
+
+const statusRequestPending = 491
+
+var (
+	// ErrGlare is returned when a remote offer arrives while a local offer is pending.
+	// The request carrying the remote offer must be answered with 491 Request Pending.
+	ErrGlare = errors.New("offer collision: local offer pending")
+	// ErrInvalidState is returned when an offer or answer is out of order.
+	ErrInvalidState = errors.New("invalid signaling state")
+	// ErrAnswerNotSubset is returned when the remote answer does not match the local offer.
+	ErrAnswerNotSubset = errors.New("answer is not a subset of the offer")
+)
+
+// Session keeps track of the local and remote descriptions exchanged over the
+// lifetime of a call and produces offers and answers for it.
+type Session struct {
+	mu sync.Mutex
+
+	cfg     *config
+	connSIP UDPConn
+	conns   map[string]mediaConns
+
+	sessionID      uint64
+	sessionVersion uint64
+	stamped        bool
+
+	state     SignalingState
+	isOfferer bool
+	direction Direction
+
+	localDescription   *sdp.SessionDescription
+	remoteDescription  *sdp.SessionDescription
+	pendingLocal       *sdp.SessionDescription
+	pendingRemote      *sdp.SessionDescription
+	remoteSessionID    uint64
+	remoteVersionKnown bool
+	remoteVersion      uint64
+}
+
+// NewSession returns a negotiator for the audio sent and received on connRTP and connRTCP.
+func NewSession(connSIP, connRTP, connRTCP UDPConn, opts ...Option) *Session {
+	return newSession(newConfig(opts), connSIP, map[string]mediaConns{
+		mediaAudio: {connRTP: connRTP, connRTCP: connRTCP},
+	})
+}
+
+func newSession(cfg *config, connSIP UDPConn, conns map[string]mediaConns) *Session {
+	sessionID := uint64(rand.Uint32())
+
+	return &Session{
+		cfg:            cfg,
+		connSIP:        connSIP,
+		conns:          conns,
+		sessionID:      sessionID,
+		sessionVersion: sessionID,
+	}
+}
+
+// AddStream sets the connections used by the m= line of the given media,
+// e.g. "video", in the next offer or answer.
+func (s *Session) AddStream(media string, connRTP, connRTCP UDPConn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.conns[media] = mediaConns{connRTP: connRTP, connRTCP: connRTCP}
+}
+
+// State returns the current signaling state.
+func (s *Session) State() SignalingState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.state
+}
+
+// IsOfferer reports whether the last offer, pending or completed, was created locally.
+func (s *Session) IsOfferer() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.isOfferer
+}
+
+// Direction returns the local media direction agreed in the last completed
+// exchange, sendrecv before any.
+func (s *Session) Direction() Direction {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.direction == "" {
+		return DirectionSendRecv
+	}
+
+	return s.direction
+}
+
+// SetDirection changes the local direction used by the next offer or
+// answer, e.g. sendonly to put the call on hold with a re-offer.
+func (s *Session) SetDirection(direction Direction) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.cfg.direction = direction
+}
+
+// LocalDescription returns the last local description agreed upon, or nil.
+func (s *Session) LocalDescription() *sdp.SessionDescription {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.localDescription
+}
+
+// RemoteDescription returns the last remote description agreed upon, or nil.
+func (s *Session) RemoteDescription() *sdp.SessionDescription {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.remoteDescription
+}
+
+// CreateOffer creates a new local offer, initial or re-offer, and moves the
+// session to have-local-offer.
+func (s *Session) CreateOffer() ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.state == StateHaveRemoteOffer || s.state == StateHaveLocalOffer {
+		return nil, fmt.Errorf("creating offer in state %s: %w", s.state, ErrInvalidState)
+	}
+
+	offer, err := offerLocalSDP(s.cfg, perMediaConns(s.conns))
+	if err != nil {
+		return nil, fmt.Errorf("creating local offer: %w", err)
+	}
+
+	s.stampOrigin(offer)
+
+	data, err := offer.Marshal()
+	if err != nil {
+		return nil, fmt.Errorf("marshaling local offer: %w", err)
+	}
+
+	s.pendingLocal = offer
+	s.state = StateHaveLocalOffer
+	s.isOfferer = true
+
+	return data, nil
+}
+
+// SetRemoteAnswer applies the answer to the pending local offer after
+// checking it only contains what was offered.
+func (s *Session) SetRemoteAnswer(body []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.state != StateHaveLocalOffer {
+		return fmt.Errorf("setting remote answer in state %s: %w", s.state, ErrInvalidState)
+	}
+
+	answer, err := unmarshalSDP(body)
+	if err != nil {
+		return fmt.Errorf("unmarshaling remote answer: %w", err)
+	}
+
+	if err := validateAnswer(s.pendingLocal, answer); err != nil {
+		return err
+	}
+
+	if err := s.checkRemoteOrigin(answer); err != nil {
+		return err
+	}
+
+	s.recordRemoteOrigin(answer)
+
+	if len(answer.MediaDescriptions) > 0 {
+		s.direction = parseDirection(answer, answer.MediaDescriptions[0]).answer(s.cfg.direction)
+	}
+
+	s.localDescription = s.pendingLocal
+	s.remoteDescription = answer
+	s.pendingLocal = nil
+	s.state = StateStable
+
+	return nil
+}
+
+// SetRemoteOffer records a remote offer, initial or re-offer. It returns
+// ErrGlare when a local offer is still pending.
+func (s *Session) SetRemoteOffer(body []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch s.state {
+	case StateHaveLocalOffer:
+		return fmt.Errorf("setting remote offer in state %s: %w", s.state, ErrGlare)
+	case StateHaveRemoteOffer:
+		return fmt.Errorf("setting remote offer in state %s: %w", s.state, ErrInvalidState)
+	}
+
+	offer, err := unmarshalSDP(body)
+	if err != nil {
+		return fmt.Errorf("unmarshaling remote offer: %w", err)
+	}
+
+	if err := s.checkRemoteOrigin(offer); err != nil {
+		return err
+	}
+
+	s.pendingRemote = offer
+	s.state = StateHaveRemoteOffer
+	s.isOfferer = false
+
+	return nil
+}
+
+// CreateAnswer answers the pending remote offer and moves the session back
+// to stable. It also returns the selected format.
+func (s *Session) CreateAnswer() ([]byte, string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.state != StateHaveRemoteOffer {
+		return nil, "", fmt.Errorf("creating answer in state %s: %w", s.state, ErrInvalidState)
+	}
+
+	answer, streams, err := negotiateLocalSDP(s.pendingRemote, s.cfg, s.connSIP, perMediaConns(s.conns))
+	if err != nil {
+		return nil, "", fmt.Errorf("negotiating local answer: %w", err)
+	}
+
+	s.stampOrigin(answer)
+
+	data, err := answer.Marshal()
+	if err != nil {
+		return nil, "", fmt.Errorf("marshaling local answer: %w", err)
+	}
+
+	if len(streams) > 0 {
+		s.direction = streams[0].direction
+	}
+
+	for _, stream := range streams {
+		if pair, ok := s.conns[stream.media]; ok && stream.rtcpMux {
+			pair.connRTCP = nil // closed by negotiateLocalSDP
+			s.conns[stream.media] = pair
+		}
+	}
+
+	s.recordRemoteOrigin(s.pendingRemote)
+
+	s.localDescription = answer
+	s.remoteDescription = s.pendingRemote
+	s.pendingRemote = nil
+	s.state = StateStable
+
+	return data, selectedFormat(streams), nil
+}
+
+// Rollback discards the pending offer, local or remote, and returns the
+// session to stable, e.g. after sending or receiving 491 Request Pending.
+func (s *Session) Rollback() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.pendingLocal = nil
+	s.pendingRemote = nil
+	s.state = StateStable
+}
+
+// stampOrigin sets the session id and a version greater than any previous one.
+func (s *Session) stampOrigin(desc *sdp.SessionDescription) {
+	if s.stamped {
+		s.sessionVersion++
+	}
+
+	s.stamped = true
+
+	desc.Origin.SessionID = s.sessionID
+	desc.Origin.SessionVersion = s.sessionVersion
+}
+
+// checkRemoteOrigin rejects a remote description whose o= version went
+// backwards or whose session id changed mid-session.
+func (s *Session) checkRemoteOrigin(desc *sdp.SessionDescription) error {
+	if !s.remoteVersionKnown {
+		return nil
+	}
+
+	if desc.Origin.SessionID != s.remoteSessionID {
+		return fmt.Errorf("remote session id changed from %d to %d: %w", s.remoteSessionID, desc.Origin.SessionID, ErrInvalidState)
+	}
+
+	if desc.Origin.SessionVersion < s.remoteVersion {
+		return fmt.Errorf("remote session version went back from %d to %d: %w", s.remoteVersion, desc.Origin.SessionVersion, ErrInvalidState)
+	}
+
+	return nil
+}
+
+// recordRemoteOrigin remembers the o= line of a remote description once its
+// offer/answer exchange completes, so that a rolled back offer leaves no trace.
+func (s *Session) recordRemoteOrigin(desc *sdp.SessionDescription) {
+	s.remoteVersionKnown = true
+	s.remoteSessionID = desc.Origin.SessionID
+	s.remoteVersion = desc.Origin.SessionVersion
+}
+
+// validateAnswer checks the rules of RFC 3264 section 6: same number and
+// kind of m= lines, and formats of accepted streams taken from the offer.
+func validateAnswer(offer, answer *sdp.SessionDescription) error {
+	if len(offer.MediaDescriptions) != len(answer.MediaDescriptions) {
+		return fmt.Errorf("offer has %d m= lines but answer has %d: %w",
+			len(offer.MediaDescriptions), len(answer.MediaDescriptions), ErrAnswerNotSubset)
+	}
+
+	for i, answerMedia := range answer.MediaDescriptions {
+		offerMedia := offer.MediaDescriptions[i]
+		if answerMedia.MediaName.Media != offerMedia.MediaName.Media {
+			return fmt.Errorf("m= line %d is %s in the offer but %s in the answer: %w",
+				i, offerMedia.MediaName.Media, answerMedia.MediaName.Media, ErrAnswerNotSubset)
+		}
+
+		if answerMedia.MediaName.Port.Value == 0 {
+			continue
+		}
+
+		if offerMedia.MediaName.Port.Value == 0 {
+			return fmt.Errorf("m= line %d was rejected in the offer: %w", i, ErrAnswerNotSubset)
+		}
+
+		if len(answerMedia.MediaName.Formats) == 0 {
+			return fmt.Errorf("m= line %d has no formats: %w", i, ErrAnswerNotSubset)
+		}
+
+		for _, format := range answerMedia.MediaName.Formats {
+			if !slices.Contains(offerMedia.MediaName.Formats, format) {
+				return fmt.Errorf("format %s in m= line %d was not offered: %w", format, i, ErrAnswerNotSubset)
+			}
+		}
+	}
+
+	return nil
+}
+
+// CreateRequestPendingResponse builds the 491 Request Pending sent back for
+// a re-INVITE that collided with a local one (RFC 3261 section 14.2).
+func CreateRequestPendingResponse(req *sip.Request) *sip.Response {
+	resp := sip.NewResponseFromRequest(req, statusRequestPending, "Request Pending", nil)
+	resp.AppendHeader(sip.NewHeader("User-Agent", UserAgent))
+
+	return resp
+}
+
+// GlareRetryAfter returns how long to wait before retrying a re-INVITE
+// rejected with 491, as chosen by RFC 3261 section 14.1: between 2.1 and 4
+// seconds for the owner of the Call-ID, between 0 and 2 seconds otherwise.
+func GlareRetryAfter(callIDOwner bool) time.Duration {
+	const step = 10 * time.Millisecond
+
+	if callIDOwner {
+		return 2100*time.Millisecond + time.Duration(rand.IntN(191))*step
+	}
+
+	return time.Duration(rand.IntN(201)) * step
+}
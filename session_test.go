@@ -0,0 +1,94 @@
+package sdp
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/pion/sdp/v4"
+)
+
+func TestValidateAnswer(t *testing.T) {
+	media := func(kind string, port int, formats ...string) *sdp.MediaDescription {
+		return &sdp.MediaDescription{MediaName: sdp.MediaName{
+			Media:   kind,
+			Port:    sdp.RangedPort{Value: port},
+			Protos:  []string{"RTP", "AVP"},
+			Formats: formats,
+		}}
+	}
+
+	session := func(medias ...*sdp.MediaDescription) *sdp.SessionDescription {
+		return &sdp.SessionDescription{MediaDescriptions: medias}
+	}
+
+	offer := session(media(mediaAudio, 5000, "0", "8", "101"), media(mediaVideo, 5002, "96"), media(mediaVideo, 0, "97"))
+
+	tests := []struct {
+		name    string
+		answer  *sdp.SessionDescription
+		wantErr bool
+	}{
+		{name: "subset", answer: session(media(mediaAudio, 6000, "8", "101"), media(mediaVideo, 6002, "96"), media(mediaVideo, 0, "97"))},
+		{name: "stream rejected", answer: session(media(mediaAudio, 6000, "0"), media(mediaVideo, 0, "96"), media(mediaVideo, 0, "97"))},
+		{name: "missing m= line", answer: session(media(mediaAudio, 6000, "0"), media(mediaVideo, 6002, "96")), wantErr: true},
+		{name: "other media", answer: session(media(mediaVideo, 6000, "96"), media(mediaVideo, 6002, "96"), media(mediaVideo, 0, "97")), wantErr: true},
+		{name: "format not offered", answer: session(media(mediaAudio, 6000, "9"), media(mediaVideo, 6002, "96"), media(mediaVideo, 0, "97")), wantErr: true},
+		{name: "no formats", answer: session(media(mediaAudio, 6000), media(mediaVideo, 6002, "96"), media(mediaVideo, 0, "97")), wantErr: true},
+		{name: "accepts a rejected offer", answer: session(media(mediaAudio, 6000, "0"), media(mediaVideo, 6002, "96"), media(mediaVideo, 6004, "97")), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateAnswer(offer, tt.answer)
+			if tt.wantErr != errors.Is(err, ErrAnswerNotSubset) || !tt.wantErr && err != nil {
+				t.Fatalf("validateAnswer() error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSessionOfferOutOfOrder(t *testing.T) {
+	newSession := func() *Session {
+		conns := make([]*net.UDPConn, 3)
+		for i := range conns {
+			conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+			if err != nil {
+				t.Fatalf("listening: %v", err)
+			}
+
+			t.Cleanup(func() { conn.Close() })
+			conns[i] = conn
+		}
+
+		return NewSession(conns[0], conns[1], conns[2])
+	}
+
+	offerer, answerer, other := newSession(), newSession(), newSession()
+
+	offer, err := offerer.CreateOffer()
+	if err != nil {
+		t.Fatalf("CreateOffer: %v", err)
+	}
+
+	otherOffer, err := other.CreateOffer()
+	if err != nil {
+		t.Fatalf("CreateOffer: %v", err)
+	}
+
+	if err := offerer.SetRemoteOffer(otherOffer); !errors.Is(err, ErrGlare) {
+		t.Fatalf("SetRemoteOffer() with a local offer pending: error = %v, want %v", err, ErrGlare)
+	}
+
+	if err := answerer.SetRemoteOffer(offer); err != nil {
+		t.Fatalf("SetRemoteOffer: %v", err)
+	}
+
+	if _, err := answerer.CreateOffer(); !errors.Is(err, ErrInvalidState) || errors.Is(err, ErrGlare) {
+		t.Fatalf("CreateOffer() with a remote offer pending: error = %v, want %v", err, ErrInvalidState)
+	}
+
+	if _, err := offerer.CreateOffer(); !errors.Is(err, ErrInvalidState) {
+		t.Fatalf("CreateOffer() with a local offer pending: error = %v, want %v", err, ErrInvalidState)
+	}
+}
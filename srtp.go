@@ -0,0 +1,229 @@
+package sdp
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/pion/sdp/v4"
+)
+
+const (
+	SuiteAESCM128HMACSHA180 = "AES_CM_128_HMAC_SHA1_80"
+	SuiteAESCM128HMACSHA132 = "AES_CM_128_HMAC_SHA1_32"
+	SuiteAEADAES128GCM      = "AEAD_AES_128_GCM"
+
+	cryptoHeader  = "crypto"
+	inlinePrefix  = "inline:"
+	protoRTPAVP   = "RTP/AVP"
+	protoRTPSAVP  = "RTP/SAVP"
+	maxCryptoTags = 999999999
+)
+
+// ErrUnsupportedSuite is returned for a crypto suite this package cannot key.
+var ErrUnsupportedSuite = errors.New("unsupported SRTP crypto suite")
+
+// srtpKeyLengths are the master key and salt lengths of each suite, from
+// RFC 4568 section 6.2 and RFC 7714 section 12.
+var srtpKeyLengths = map[string]struct{ key, salt int }{
+	SuiteAESCM128HMACSHA180: {key: 16, salt: 14},
+	SuiteAESCM128HMACSHA132: {key: 16, salt: 14},
+	SuiteAEADAES128GCM:      {key: 16, salt: 12},
+}
+
+// DefaultSRTPSuites are offered by WithSRTP when no suite is given, most
+// preferred first.
+func DefaultSRTPSuites() []string {
+	return []string{SuiteAEADAES128GCM, SuiteAESCM128HMACSHA180, SuiteAESCM128HMACSHA132}
+}
+
+// CryptoAttribute is an a=crypto line of RFC 4568 with a single inline key.
+// Lines with a lifetime, an MKI or session parameters are not supported.
+type CryptoAttribute struct {
+	Tag        int
+	Suite      string
+	MasterKey  []byte
+	MasterSalt []byte
+}
+
+// NewCryptoAttribute returns a line for suite with a random master key and salt.
+func NewCryptoAttribute(tag int, suite string) (CryptoAttribute, error) {
+	lengths, ok := srtpKeyLengths[suite]
+	if !ok {
+		return CryptoAttribute{}, fmt.Errorf("%w: %s", ErrUnsupportedSuite, suite)
+	}
+
+	keySalt := make([]byte, lengths.key+lengths.salt)
+	if _, err := rand.Read(keySalt); err != nil {
+		return CryptoAttribute{}, fmt.Errorf("generating SRTP master key: %w", err)
+	}
+
+	return CryptoAttribute{
+		Tag:        tag,
+		Suite:      suite,
+		MasterKey:  keySalt[:lengths.key],
+		MasterSalt: keySalt[lengths.key:],
+	}, nil
+}
+
+// ParseCryptoAttribute reads the value of an a=crypto attribute.
+func ParseCryptoAttribute(value string) (CryptoAttribute, error) {
+	fields := strings.Fields(value)
+	if len(fields) < 3 {
+		return CryptoAttribute{}, fmt.Errorf("malformed crypto attribute %q", value)
+	}
+
+	if len(fields) > 3 {
+		return CryptoAttribute{}, fmt.Errorf("session parameters in crypto attribute %q are not supported", value)
+	}
+
+	tag, err := strconv.Atoi(fields[0])
+	if err != nil || tag < 0 || tag > maxCryptoTags {
+		return CryptoAttribute{}, fmt.Errorf("invalid tag in crypto attribute %q", value)
+	}
+
+	suite := fields[1]
+
+	lengths, ok := srtpKeyLengths[suite]
+	if !ok {
+		return CryptoAttribute{}, fmt.Errorf("%w: %s", ErrUnsupportedSuite, suite)
+	}
+
+	keyParams, found := strings.CutPrefix(fields[2], inlinePrefix)
+	if !found || strings.Contains(keyParams, ";") {
+		return CryptoAttribute{}, fmt.Errorf("crypto attribute %q must have a single inline key", value)
+	}
+
+	keyInfo, lifetimeMKI, _ := strings.Cut(keyParams, "|")
+	if strings.Contains(lifetimeMKI, ":") {
+		return CryptoAttribute{}, fmt.Errorf("MKI in crypto attribute %q is not supported", value)
+	}
+
+	keySalt, err := base64.StdEncoding.DecodeString(keyInfo)
+	if err != nil {
+		keySalt, err = base64.RawStdEncoding.DecodeString(keyInfo)
+	}
+
+	if err != nil {
+		return CryptoAttribute{}, fmt.Errorf("decoding key of crypto attribute %q: %w", value, err)
+	}
+
+	if len(keySalt) != lengths.key+lengths.salt {
+		return CryptoAttribute{}, fmt.Errorf("key of crypto attribute %q has %d bytes, want %d", value, len(keySalt), lengths.key+lengths.salt)
+	}
+
+	return CryptoAttribute{
+		Tag:        tag,
+		Suite:      suite,
+		MasterKey:  keySalt[:lengths.key],
+		MasterSalt: keySalt[lengths.key:],
+	}, nil
+}
+
+// String formats the line as the value of an a=crypto attribute.
+func (c CryptoAttribute) String() string {
+	keySalt := append(slices.Clone(c.MasterKey), c.MasterSalt...)
+
+	return fmt.Sprintf("%d %s %s%s", c.Tag, c.Suite, inlinePrefix, base64.StdEncoding.EncodeToString(keySalt))
+}
+
+func (c CryptoAttribute) attribute() sdp.Attribute {
+	return sdp.Attribute{Key: cryptoHeader, Value: c.String()}
+}
+
+// SRTPKeys is the keying material agreed for a stream: the local key
+// protects what is sent and the remote one what is received.
+type SRTPKeys struct {
+	Suite            string
+	LocalMasterKey   []byte
+	LocalMasterSalt  []byte
+	RemoteMasterKey  []byte
+	RemoteMasterSalt []byte
+}
+
+func newSRTPKeys(local, remote CryptoAttribute) *SRTPKeys {
+	return &SRTPKeys{
+		Suite:            local.Suite,
+		LocalMasterKey:   local.MasterKey,
+		LocalMasterSalt:  local.MasterSalt,
+		RemoteMasterKey:  remote.MasterKey,
+		RemoteMasterSalt: remote.MasterSalt,
+	}
+}
+
+// parseCryptoAttributes returns the supported a=crypto lines of the m= line.
+func parseCryptoAttributes(md *sdp.MediaDescription) []CryptoAttribute {
+	cryptos := []CryptoAttribute{}
+
+	for _, attr := range md.Attributes {
+		if attr.Key != cryptoHeader {
+			continue
+		}
+
+		if crypto, err := ParseCryptoAttribute(attr.Value); err == nil {
+			cryptos = append(cryptos, crypto)
+		}
+	}
+
+	return cryptos
+}
+
+// offerCryptos returns one line with a fresh key per configured suite.
+func (cfg *config) offerCryptos() ([]CryptoAttribute, error) {
+	cryptos := []CryptoAttribute{}
+
+	for i, suite := range cfg.srtpSuites {
+		crypto, err := NewCryptoAttribute(i+1, suite)
+		if err != nil {
+			return nil, err
+		}
+
+		cryptos = append(cryptos, crypto)
+	}
+
+	return cryptos, nil
+}
+
+// answerCrypto picks the first remote line with a configured suite and
+// returns it along with the local line that answers it.
+func (cfg *config) answerCrypto(md *sdp.MediaDescription) (CryptoAttribute, CryptoAttribute, bool, error) {
+	for _, remote := range parseCryptoAttributes(md) {
+		if !slices.Contains(cfg.srtpSuites, remote.Suite) {
+			continue
+		}
+
+		local, err := NewCryptoAttribute(remote.Tag, remote.Suite)
+		if err != nil {
+			return CryptoAttribute{}, CryptoAttribute{}, false, err
+		}
+
+		return local, remote, true, nil
+	}
+
+	return CryptoAttribute{}, CryptoAttribute{}, false, nil
+}
+
+// answeredSRTPKeys matches the a=crypto line of an answer with the offered
+// line of the same tag.
+func answeredSRTPKeys(offer, answer *sdp.MediaDescription) *SRTPKeys {
+	answered := parseCryptoAttributes(answer)
+	if len(answered) == 0 {
+		return nil
+	}
+
+	for _, local := range parseCryptoAttributes(offer) {
+		if local.Tag == answered[0].Tag && local.Suite == answered[0].Suite {
+			return newSRTPKeys(local, answered[0])
+		}
+	}
+
+	return nil
+}
+
+func mediaProto(md *sdp.MediaDescription) string {
+	return strings.Join(md.MediaName.Protos, "/")
+}
@@ -0,0 +1,245 @@
+package sdp
+
+import (
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/emiago/sipgo/sip"
+	"github.com/pion/sdp/v4"
+)
+
+// StreamResult describes one accepted m= line of an SDP exchange.
+type StreamResult struct {
+	Index            int    // position of the m= line in the description
+	Media            string // "audio", "video", ...
+	Format           string
+	Codec            Codec           // the selected codec with the agreed fmtp
+	PayloadType      uint8           // of the selected codec, as used on the wire
+	ClockRate        int             // of the selected codec
+	Opus             *OpusConfig     // encoder settings when Codec is opus, nil otherwise
+	Ptime            int             // agreed packetization time in ms, 0 for video
+	MaxPtime         int             // 0 if no limit
+	Direction        Direction       // what the local side does
+	DTMFPayloadType  int             // agreed telephone-event payload type, -1 if none
+	RTCPMux          bool            // RTCP is sent and received on the RTP connection
+	LocalICE         *ICECredentials // nil unless published locally with WithICELite
+	RemoteICE        *ICECredentials // nil if the remote description has none
+	RemoteCandidates []ICECandidate
+	SRTP             *SRTPKeys       // nil for RTP/AVP, or if the local offer is unknown
+	DTLS             *DTLSParameters // nil unless UDP/TLS/RTP/SAVPF is used with WithDTLS
+	RemoteRTP        *net.UDPAddr
+	RemoteRTCP       *net.UDPAddr // equal to RemoteRTP when RTCPMux is set
+	ConnRTP          *net.UDPConn // nil when obtained from a remote description only
+	ConnRTCP         *net.UDPConn // nil when RTCPMux is set, except for a local offer
+}
+
+// NegotiateStreams answers every m= line of the offer in req, allocating a
+// pair of RTP and RTCP connections per accepted stream, or an RTP one only
+// when RTCP is multiplexed. Unsupported streams are rejected with port 0.
+// On error no connection is left open.
+func NegotiateStreams(req *sip.Request, connSIP UDPConn, opts ...Option) (*sip.Response, []StreamResult, error) {
+	resp, result, err := Negotiate(req, connSIP, opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return resp, result.Streams, nil
+}
+
+// ObtainStreams describes every accepted m= line of a remote description,
+// typically the answer to a local offer.
+func ObtainStreams(body []byte, opts ...Option) ([]StreamResult, error) {
+	remoteSDP, err := unmarshalSDP(body)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshaling SDP: %w", err)
+	}
+
+	return obtainStreams(remoteSDP, newConfig(opts))
+}
+
+func obtainStreams(remoteSDP *sdp.SessionDescription, cfg *config) ([]StreamResult, error) {
+	if cfg.err != nil {
+		return nil, cfg.err
+	}
+
+	results := []StreamResult{}
+
+	for i, md := range remoteSDP.MediaDescriptions {
+		if md.MediaName.Port.Value == 0 {
+			continue
+		}
+
+		result, ok, err := obtainStream(remoteSDP, i, cfg)
+		if err != nil {
+			return nil, err
+		}
+
+		if ok {
+			results = append(results, result)
+		}
+	}
+
+	return results, nil
+}
+
+// obtainStream reads the format, ptime and remote addresses of the m= line
+// at index. It reports false if no format of it is registered.
+func obtainStream(remoteSDP *sdp.SessionDescription, index int, cfg *config) (StreamResult, bool, error) {
+	result, ok := describeStream(remoteSDP, index, cfg)
+	if !ok {
+		return result, false, nil
+	}
+
+	addrRTP, addrRTCP, err := resolveRemoteTransport(remoteSDP, remoteSDP.MediaDescriptions[index], result.RTCPMux)
+	if err != nil {
+		return result, false, fmt.Errorf("resolving remote transport of m= line %d: %w", index, err)
+	}
+
+	result.RemoteRTP = addrRTP
+	result.RemoteRTCP = addrRTCP
+
+	return result, true, nil
+}
+
+// describeStream is obtainStream without the remote addresses, which an
+// answerer resolves while negotiating.
+func describeStream(remoteSDP *sdp.SessionDescription, index int, cfg *config) (StreamResult, bool) {
+	md := remoteSDP.MediaDescriptions[index]
+	result := StreamResult{
+		Index:           index,
+		Media:           md.MediaName.Media,
+		Direction:       parseDirection(remoteSDP, md).answer(cfg.direction),
+		DTMFPayloadType: -1,
+	}
+
+	codecs := negotiateCodecs(cfg.codecs, md)
+	if len(codecs) == 0 {
+		return result, false
+	}
+
+	result.Codec = codecs[0]
+	result.Format = result.Codec.Format()
+	result.PayloadType = result.Codec.PayloadType
+	result.ClockRate = result.Codec.ClockRate
+
+	for _, codec := range codecs {
+		if isTelephoneEvent(codec) {
+			result.DTMFPayloadType = int(codec.PayloadType)
+		}
+	}
+
+	if result.Media == mediaAudio {
+		remotePtime, remoteMaxptime := parsePtimes(md)
+		result.Ptime = agreedPtime(result.Codec, remotePtime, remoteMaxptime)
+		result.MaxPtime = agreedMaxptime(result.Codec, remoteMaxptime)
+	}
+
+	result.Opus = opusConfig(result.Codec, md)
+	result.RTCPMux = !cfg.noRTCPMux && hasRTCPMux(md)
+
+	if cfg.localOffer != nil && index < len(cfg.localOffer.MediaDescriptions) {
+		result.SRTP = answeredSRTPKeys(cfg.localOffer.MediaDescriptions[index], md)
+	}
+
+	if cfg.dtlsCert != nil && mediaProto(md) == protoDTLS {
+		if role, ok := answeredSetup(parseSetup(remoteSDP, md, false)); ok {
+			result.DTLS = &DTLSParameters{
+				Role:               role,
+				Certificate:        *cfg.dtlsCert,
+				RemoteFingerprints: parseFingerprints(remoteSDP, md),
+			}
+		}
+	}
+
+	result.RemoteICE = parseICECredentials(remoteSDP, md)
+	result.RemoteCandidates = parseICECandidates(md)
+
+	return result, true
+}
+
+// answeredStream describes a stream of a local answer from what
+// negotiateLocalSDP agreed for it, and from the remote ICE attributes of the
+// offer it answers.
+func answeredStream(remoteSDP *sdp.SessionDescription, stream negotiatedStream, cfg *config) StreamResult {
+	md := remoteSDP.MediaDescriptions[stream.index]
+	codec := stream.codecs[0]
+
+	result := StreamResult{
+		Index:            stream.index,
+		Media:            stream.media,
+		Format:           codec.Format(),
+		Codec:            codec,
+		PayloadType:      codec.PayloadType,
+		ClockRate:        codec.ClockRate,
+		Opus:             opusConfig(codec, md),
+		Direction:        stream.direction,
+		DTMFPayloadType:  -1,
+		RTCPMux:          stream.rtcpMux,
+		RemoteICE:        parseICECredentials(remoteSDP, md),
+		RemoteCandidates: parseICECandidates(md),
+		SRTP:             stream.srtp,
+		DTLS:             stream.dtls,
+		RemoteRTP:        stream.remoteRTP,
+		RemoteRTCP:       stream.remoteRTCP,
+	}
+
+	for _, codec := range stream.codecs {
+		if isTelephoneEvent(codec) {
+			result.DTMFPayloadType = int(codec.PayloadType)
+		}
+	}
+
+	if stream.media == mediaAudio {
+		result.Ptime = stream.ptime
+		result.MaxPtime = stream.maxptime
+	}
+
+	if stream.ice {
+		result.LocalICE = cfg.ice
+	}
+
+	result.ConnRTP, _ = stream.connRTP.(*net.UDPConn)
+	if stream.connRTCP != nil {
+		result.ConnRTCP, _ = stream.connRTCP.(*net.UDPConn)
+	}
+
+	return result
+}
+
+// opusConfig returns the encoder settings of codec when it is opus, given
+// the fmtp the remote side sent for its payload type in md.
+func opusConfig(codec Codec, md *sdp.MediaDescription) *OpusConfig {
+	if !isOpus(codec) {
+		return nil
+	}
+
+	for _, remoteCodec := range parseRemoteFormats(md) {
+		if remoteCodec.PayloadType == codec.PayloadType {
+			return newOpusConfig(codec.Fmtp, remoteCodec.Fmtp)
+		}
+	}
+
+	return nil
+}
+
+// closeStreams closes the local connections of the streams.
+func closeStreams(streams []StreamResult) error {
+	var errFinal error
+
+	for _, stream := range streams {
+		if stream.ConnRTP != nil {
+			if err := stream.ConnRTP.Close(); err != nil {
+				errFinal = errors.Join(errFinal, fmt.Errorf("closing RTP connection: %w", err))
+			}
+		}
+
+		if stream.ConnRTCP != nil {
+			if err := stream.ConnRTCP.Close(); err != nil {
+				errFinal = errors.Join(errFinal, fmt.Errorf("closing RTCP connection: %w", err))
+			}
+		}
+	}
+
+	return errFinal
+}
@@ -0,0 +1,151 @@
+package sdp
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/pion/stun/v3"
+)
+
+const (
+	DefaultSTUNTimeout = time.Second
+	stunInitialRTO     = 100 * time.Millisecond
+	stunMaxPacketSize  = 1500
+)
+
+var (
+	// ErrSTUNTimeout is returned when a STUN server does not answer in time.
+	ErrSTUNTimeout = errors.New("STUN binding request timed out")
+	// ErrSTUNBinding is returned when a STUN server rejects a binding request.
+	ErrSTUNBinding = errors.New("STUN binding request failed")
+)
+
+// DiscoverMappedAddress sends a STUN binding request from conn to server,
+// retransmitting it with exponential backoff until timeout, and returns the
+// server-reflexive address conn is seen from. It must be called before conn
+// carries media, since the packets read meanwhile are dropped.
+func DiscoverMappedAddress(conn *net.UDPConn, server string, timeout time.Duration) (*net.UDPAddr, error) {
+	serverAddr, err := net.ResolveUDPAddr("udp", server)
+	if err != nil {
+		return nil, fmt.Errorf("resolving STUN server %s: %w", server, err)
+	}
+
+	req, err := stun.Build(stun.TransactionID, stun.BindingRequest, stun.Fingerprint)
+	if err != nil {
+		return nil, fmt.Errorf("building STUN binding request: %w", err)
+	}
+
+	defer conn.SetReadDeadline(time.Time{})
+
+	buf := make([]byte, stunMaxPacketSize)
+	deadline := time.Now().Add(timeout)
+
+	for rto := stunInitialRTO; time.Now().Before(deadline); rto *= 2 {
+		if _, err := conn.WriteTo(req.Raw, serverAddr); err != nil {
+			return nil, fmt.Errorf("sending STUN binding request to %s: %w", serverAddr, err)
+		}
+
+		readDeadline := time.Now().Add(rto)
+		if readDeadline.After(deadline) {
+			readDeadline = deadline
+		}
+
+		if err := conn.SetReadDeadline(readDeadline); err != nil {
+			return nil, fmt.Errorf("setting read deadline: %w", err)
+		}
+
+		mapped, err := readBindingResponse(conn, buf, req.TransactionID)
+		if err == nil {
+			return mapped, nil
+		}
+
+		var netErr net.Error
+		if !errors.As(err, &netErr) || !netErr.Timeout() {
+			return nil, err
+		}
+	}
+
+	return nil, fmt.Errorf("%w after %s with %s", ErrSTUNTimeout, timeout, serverAddr)
+}
+
+// readBindingResponse reads until the response to the transaction arrives,
+// ignoring anything else, or the read deadline expires.
+func readBindingResponse(conn *net.UDPConn, buf []byte, transactionID [stun.TransactionIDSize]byte) (*net.UDPAddr, error) {
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			return nil, err
+		}
+
+		if !stun.IsMessage(buf[:n]) {
+			continue
+		}
+
+		resp := &stun.Message{Raw: append([]byte{}, buf[:n]...)}
+		if err := resp.Decode(); err != nil || resp.TransactionID != transactionID {
+			continue
+		}
+
+		if resp.Type == stun.BindingError {
+			var errorCode stun.ErrorCodeAttribute
+			if err := errorCode.GetFrom(resp); err != nil {
+				return nil, ErrSTUNBinding
+			}
+
+			return nil, fmt.Errorf("%w: %s", ErrSTUNBinding, errorCode)
+		}
+
+		var xorAddr stun.XORMappedAddress
+		if err := xorAddr.GetFrom(resp); err == nil {
+			return &net.UDPAddr{IP: xorAddr.IP, Port: xorAddr.Port}, nil
+		}
+
+		var addr stun.MappedAddress
+		if err := addr.GetFrom(resp); err != nil {
+			return nil, fmt.Errorf("%w: no mapped address in response", ErrSTUNBinding)
+		}
+
+		return &net.UDPAddr{IP: addr.IP, Port: addr.Port}, nil
+	}
+}
+
+// discoverMapping records the server-reflexive address of conn in the port
+// allocator when a STUN server is configured. On failure the advertised or
+// local address is used instead.
+func (cfg *config) discoverMapping(conn *net.UDPConn) {
+	if cfg.stunServer == "" || conn == nil {
+		return
+	}
+
+	mapped, err := DiscoverMappedAddress(conn, cfg.stunServer, cfg.stunTimeout)
+	if err != nil {
+		cfg.logger.Debug("STUN discovery failed, advertising the local address",
+			"local", conn.LocalAddr(),
+			"server", cfg.stunServer,
+			"error", err,
+		)
+
+		return
+	}
+
+	cfg.logger.Debug("discovered STUN mapping", "local", conn.LocalAddr(), "mapped", mapped)
+
+	cfg.ports.setMapped(conn, mapped)
+}
+
+// discoverMappings runs discoverMapping on every connection at once, so that
+// the STUN timeouts of a pair do not add up.
+func (cfg *config) discoverMappings(conns ...*net.UDPConn) {
+	var wg sync.WaitGroup
+
+	for _, conn := range conns {
+		wg.Go(func() {
+			cfg.discoverMapping(conn)
+		})
+	}
+
+	wg.Wait()
+}
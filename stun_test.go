@@ -0,0 +1,142 @@
+package sdp
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/pion/stun/v3"
+)
+
+// stunResponder answers binding requests on a loopback socket the way a STUN
+// server would, after dropping the first drop requests.
+func stunResponder(t *testing.T, drop int, errorCode stun.ErrorCode) string {
+	t.Helper()
+
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("listening: %v", err)
+	}
+
+	t.Cleanup(func() { conn.Close() })
+
+	go func() {
+		buf := make([]byte, stunMaxPacketSize)
+
+		for {
+			n, addr, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+
+			req := &stun.Message{Raw: append([]byte{}, buf[:n]...)}
+			if err := req.Decode(); err != nil || req.Type != stun.BindingRequest {
+				continue
+			}
+
+			if drop > 0 {
+				drop--
+
+				continue
+			}
+
+			setters := []stun.Setter{
+				stun.NewTransactionIDSetter(req.TransactionID),
+				stun.BindingSuccess,
+				&stun.XORMappedAddress{IP: addr.IP, Port: addr.Port},
+			}
+
+			if errorCode != 0 {
+				setters = []stun.Setter{
+					stun.NewTransactionIDSetter(req.TransactionID),
+					stun.BindingError,
+					errorCode,
+				}
+			}
+
+			resp := stun.MustBuild(append(setters, stun.Fingerprint)...)
+			conn.WriteToUDP(resp.Raw, addr)
+		}
+	}()
+
+	return conn.LocalAddr().String()
+}
+
+func TestDiscoverMappedAddress(t *testing.T) {
+	tests := []struct {
+		name      string
+		drop      int
+		errorCode stun.ErrorCode
+		timeout   time.Duration
+		wantErr   error
+	}{
+		{name: "answered", timeout: time.Second},
+		{name: "answered after a retransmission", drop: 1, timeout: time.Second},
+		{name: "rejected", errorCode: stun.CodeBadRequest, timeout: time.Second, wantErr: ErrSTUNBinding},
+		{name: "never answered", drop: 100, timeout: 250 * time.Millisecond, wantErr: ErrSTUNTimeout},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := stunResponder(t, tt.drop, tt.errorCode)
+
+			conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+			if err != nil {
+				t.Fatalf("listening: %v", err)
+			}
+			defer conn.Close()
+
+			mapped, err := DiscoverMappedAddress(conn, server, tt.timeout)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("DiscoverMappedAddress() error = %v, want %v", err, tt.wantErr)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("DiscoverMappedAddress: %v", err)
+			}
+
+			if local := conn.LocalAddr().(*net.UDPAddr); !mapped.IP.Equal(local.IP) || mapped.Port != local.Port {
+				t.Fatalf("mapped address = %s, want %s", mapped, local)
+			}
+		})
+	}
+}
+
+func TestDiscoverMappingsConcurrently(t *testing.T) {
+	const timeout = 200 * time.Millisecond
+
+	ports, err := NewPortAllocator(30000, 30100)
+	if err != nil {
+		t.Fatalf("NewPortAllocator: %v", err)
+	}
+
+	connSIP, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("listening: %v", err)
+	}
+	defer connSIP.Close()
+
+	cfg := newConfig([]Option{
+		WithPortAllocator(ports),
+		WithSTUNServer(stunResponder(t, 100, 0)),
+		WithSTUNTimeout(timeout),
+	})
+
+	start := time.Now()
+
+	connRTP, connRTCP, err := generateNewRTPAndRTCP(connSIP, cfg)
+	if err != nil {
+		t.Fatalf("generateNewRTPAndRTCP: %v", err)
+	}
+	defer connRTP.Close()
+	defer connRTCP.Close()
+
+	if elapsed := time.Since(start); elapsed >= 2*timeout {
+		t.Fatalf("discovery of the pair took %s, want less than %s", elapsed, 2*timeout)
+	}
+}
@@ -0,0 +1,762 @@
+package sdp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/emiago/sipgo/sip"
+)
+
+// Timer values of RFC 3261 section 17.1.1.1 and table 4.
+const (
+	DefaultT1 = 500 * time.Millisecond
+	DefaultT2 = 4 * time.Second
+	DefaultT4 = 5 * time.Second
+
+	responseBuffer = 16
+)
+
+var (
+	// ErrTransactionTimeout is wrapped by TimeoutError.
+	ErrTransactionTimeout = errors.New("transaction timed out")
+	// ErrTransactionExists is returned when a request is sent twice with the
+	// same branch.
+	ErrTransactionExists = errors.New("transaction already exists")
+	// ErrTransactionState is returned when responding in a state that does not
+	// allow it, e.g. after a final response.
+	ErrTransactionState = errors.New("invalid transaction state")
+	// ErrNoBranch is returned for a request whose top Via has no branch
+	// starting with the RFC 3261 magic cookie.
+	ErrNoBranch = errors.New("no RFC 3261 branch in Via")
+)
+
+// TimeoutError reports the timer that ended a transaction: B or F when no
+// final response arrived and H when no ACK arrived for a non-2xx final
+// response. Timer L ending the Accepted state of RFC 6026 is not an error,
+// ACK or not, since the ACK for a 2xx belongs to the dialog.
+type TimeoutError struct {
+	Timer  string
+	Method sip.RequestMethod
+	Branch string
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("%s transaction %s: timer %s fired", e.Method, e.Branch, e.Timer)
+}
+
+func (e *TimeoutError) Unwrap() error {
+	return ErrTransactionTimeout
+}
+
+// TransactionState is a state of the machines of RFC 3261 section 17.
+type TransactionState int
+
+const (
+	TransactionCalling TransactionState = iota
+	TransactionTrying
+	TransactionProceeding
+	TransactionCompleted
+	TransactionConfirmed
+	TransactionAccepted
+	TransactionTerminated
+)
+
+func (s TransactionState) String() string {
+	switch s {
+	case TransactionCalling:
+		return "calling"
+	case TransactionTrying:
+		return "trying"
+	case TransactionProceeding:
+		return "proceeding"
+	case TransactionCompleted:
+		return "completed"
+	case TransactionConfirmed:
+		return "confirmed"
+	case TransactionAccepted:
+		return "accepted"
+	case TransactionTerminated:
+		return "terminated"
+	}
+
+	return fmt.Sprintf("TransactionState(%d)", int(s))
+}
+
+// TransactionLayer sends requests and responses over an unreliable
+// transport, retransmitting them until the peer acknowledges them as RFC 3261
+// section 17 describes. It does not read from conn: the caller passes what
+// it receives to HandleRequest and HandleResponse. It is safe for
+// concurrent use.
+type TransactionLayer struct {
+	conn net.PacketConn
+	cfg  *config
+
+	mu      sync.Mutex
+	clients map[string]*ClientTransaction
+	servers map[string]*ServerTransaction
+}
+
+// NewTransactionLayer returns a layer sending on conn, typically the SIP
+// connection.
+func NewTransactionLayer(conn net.PacketConn, opts ...Option) *TransactionLayer {
+	return &TransactionLayer{
+		conn:    conn,
+		cfg:     newConfig(opts),
+		clients: map[string]*ClientTransaction{},
+		servers: map[string]*ServerTransaction{},
+	}
+}
+
+// Request sends req to addr in a new client transaction. ACKs for 2xx
+// responses are not transactions and must be sent with Send.
+func (l *TransactionLayer) Request(req *sip.Request, addr net.Addr) (*ClientTransaction, error) {
+	if req.IsAck() {
+		return nil, fmt.Errorf("sending ACK in a client transaction: %w", ErrTransactionState)
+	}
+
+	branch, err := requestBranch(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.CSeq() == nil {
+		return nil, fmt.Errorf("sending %s without CSeq", req.Method)
+	}
+
+	tx := &ClientTransaction{
+		layer:     l,
+		key:       transactionKey(branch, "", req.CSeq().MethodName),
+		branch:    branch,
+		req:       req,
+		addr:      addr,
+		responses: make(chan *sip.Response, responseBuffer),
+		finalized: make(chan struct{}),
+		done:      make(chan struct{}),
+		state:     TransactionTrying,
+		interval:  l.cfg.t1,
+	}
+
+	if req.IsInvite() {
+		tx.state = TransactionCalling
+	}
+
+	l.mu.Lock()
+	if _, ok := l.clients[tx.key]; ok {
+		l.mu.Unlock()
+
+		return nil, fmt.Errorf("sending %s with branch %s: %w", req.Method, branch, ErrTransactionExists)
+	}
+
+	l.clients[tx.key] = tx
+	l.mu.Unlock()
+
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	// Timers A and B, or E and F.
+	tx.retransmit = time.AfterFunc(tx.interval, tx.onRetransmit)
+	tx.timeout = time.AfterFunc(64*l.cfg.t1, tx.onTimeout)
+
+	if err := l.write(req, addr); err != nil {
+		tx.terminate(err)
+
+		return nil, fmt.Errorf("sending %s to %s: %w", req.Method, addr, err)
+	}
+
+	return tx, nil
+}
+
+// Send writes msg once to addr, outside of any transaction.
+func (l *TransactionLayer) Send(msg sip.Message, addr net.Addr) error {
+	if err := l.write(msg, addr); err != nil {
+		return fmt.Errorf("sending SIP message to %s: %w", addr, err)
+	}
+
+	return nil
+}
+
+// HandleResponse passes a received response to its client transaction and
+// reports whether there was one. A response that matches none, such as a
+// retransmitted 2xx to an INVITE, is for the caller to handle.
+func (l *TransactionLayer) HandleResponse(resp *sip.Response) bool {
+	via := resp.Via()
+	if via == nil || resp.CSeq() == nil {
+		return false
+	}
+
+	branch, _ := via.Params.Get(branchParam)
+
+	l.mu.Lock()
+	tx, ok := l.clients[transactionKey(branch, "", resp.CSeq().MethodName)]
+	l.mu.Unlock()
+
+	if !ok {
+		return false
+	}
+
+	tx.receive(resp)
+
+	return true
+}
+
+// HandleRequest passes a request received from addr to its server
+// transaction, creating it for a new request. It reports false for a
+// retransmission or an ACK that a transaction absorbed, which the caller
+// must drop. Requests without an RFC 3261 branch and ACKs matching no
+// transaction are passed on with a nil transaction.
+func (l *TransactionLayer) HandleRequest(req *sip.Request, addr net.Addr) (*ServerTransaction, bool) {
+	branch, err := requestBranch(req)
+	if err != nil || req.CSeq() == nil || req.CallID() == nil {
+		return nil, true
+	}
+
+	via := req.Via()
+	sentBy := fmt.Sprintf("%s:%d", via.Host, via.Port)
+
+	method := req.Method
+	if req.IsAck() {
+		method = sip.INVITE
+	}
+
+	key := transactionKey(branch, sentBy, method)
+
+	l.mu.Lock()
+	tx, ok := l.servers[key]
+
+	if req.IsAck() {
+		candidates := []*ServerTransaction{}
+		if ok {
+			candidates = append(candidates, tx)
+		}
+
+		for _, invite := range l.servers {
+			if invite.req.IsInvite() && invite.callID == req.CallID().Value() && invite.seqNo == req.CSeq().SeqNo {
+				candidates = append(candidates, invite)
+			}
+		}
+		l.mu.Unlock()
+
+		for _, invite := range candidates {
+			if invite.receiveACK() {
+				return invite, false
+			}
+		}
+
+		return nil, true
+	}
+
+	if ok {
+		l.mu.Unlock()
+		tx.receiveRetransmission()
+
+		return tx, false
+	}
+
+	tx = &ServerTransaction{
+		layer:  l,
+		key:    key,
+		branch: branch,
+		req:    req,
+		addr:   addr,
+		callID: req.CallID().Value(),
+		seqNo:  req.CSeq().SeqNo,
+		done:   make(chan struct{}),
+		state:  TransactionTrying,
+	}
+
+	if req.IsInvite() {
+		tx.state = TransactionProceeding
+	}
+
+	l.servers[key] = tx
+	l.mu.Unlock()
+
+	return tx, true
+}
+
+func (l *TransactionLayer) write(msg sip.Message, addr net.Addr) error {
+	payload := msg.String()
+	if _, err := l.conn.WriteTo([]byte(payload), addr); err != nil {
+		return err
+	}
+
+	startLine, _, _ := strings.Cut(payload, "\r\n")
+	cseq, callID := messageIDs(msg)
+	l.cfg.logger.Debug("sent SIP message",
+		"start_line", startLine,
+		"cseq", cseq,
+		"call_id", callID,
+		"to", addr,
+	)
+
+	return nil
+}
+
+func (l *TransactionLayer) removeClient(tx *ClientTransaction) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.clients[tx.key] == tx {
+		delete(l.clients, tx.key)
+	}
+}
+
+func (l *TransactionLayer) removeServer(tx *ServerTransaction) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.servers[tx.key] == tx {
+		delete(l.servers, tx.key)
+	}
+}
+
+// ClientTransaction is a request sent by the layer and the responses it got.
+type ClientTransaction struct {
+	layer  *TransactionLayer
+	key    string
+	branch string
+	req    *sip.Request
+	addr   net.Addr
+
+	responses chan *sip.Response
+	finalized chan struct{}
+	done      chan struct{}
+
+	mu         sync.Mutex
+	state      TransactionState
+	final      *sip.Response
+	ack        *sip.Request
+	err        error
+	interval   time.Duration
+	retransmit *time.Timer
+	timeout    *time.Timer
+	wait       *time.Timer
+}
+
+// Request returns the request of the transaction.
+func (tx *ClientTransaction) Request() *sip.Request {
+	return tx.req
+}
+
+// State returns the current state of the transaction.
+func (tx *ClientTransaction) State() TransactionState {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	return tx.state
+}
+
+// Responses delivers the provisional and final responses, without
+// retransmissions. Responses are dropped when it is not drained.
+func (tx *ClientTransaction) Responses() <-chan *sip.Response {
+	return tx.responses
+}
+
+// Done is closed when the transaction terminates.
+func (tx *ClientTransaction) Done() <-chan struct{} {
+	return tx.done
+}
+
+// Err returns why the transaction terminated, nil if it ended normally.
+func (tx *ClientTransaction) Err() error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	return tx.err
+}
+
+// Wait returns the final response, or the error that terminated the
+// transaction before one arrived.
+func (tx *ClientTransaction) Wait(ctx context.Context) (*sip.Response, error) {
+	select {
+	case <-tx.finalized:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	if tx.final == nil {
+		return nil, tx.err
+	}
+
+	return tx.final, nil
+}
+
+// receive applies figures 5 and 6 of RFC 3261 to a response.
+func (tx *ClientTransaction) receive(resp *sip.Response) {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	switch tx.state {
+	case TransactionCalling, TransactionTrying, TransactionProceeding:
+	case TransactionCompleted:
+		if tx.ack != nil && !resp.IsProvisional() {
+			if err := tx.layer.write(tx.ack, tx.addr); err != nil {
+				tx.terminate(fmt.Errorf("sending ACK to %s: %w", tx.addr, err))
+			}
+		}
+
+		return
+	default:
+		return
+	}
+
+	if resp.IsProvisional() {
+		if tx.req.IsInvite() {
+			stopTimer(tx.retransmit)
+			stopTimer(tx.timeout)
+		}
+
+		tx.state = TransactionProceeding
+		tx.deliver(resp)
+
+		return
+	}
+
+	stopTimer(tx.retransmit)
+	stopTimer(tx.timeout)
+
+	tx.final = resp
+	close(tx.finalized)
+	tx.deliver(resp)
+
+	if tx.req.IsInvite() && resp.IsSuccess() {
+		tx.terminate(nil)
+
+		return
+	}
+
+	tx.state = TransactionCompleted
+	wait := tx.layer.cfg.t4 // Timer K
+
+	if tx.req.IsInvite() {
+		tx.ack = CreateACKforNon2xx(tx.req, resp)
+		if err := tx.layer.write(tx.ack, tx.addr); err != nil {
+			tx.terminate(fmt.Errorf("sending ACK to %s: %w", tx.addr, err))
+
+			return
+		}
+
+		wait = 64 * tx.layer.cfg.t1 // Timer D
+	}
+
+	tx.wait = time.AfterFunc(wait, func() {
+		tx.mu.Lock()
+		defer tx.mu.Unlock()
+
+		tx.terminate(nil)
+	})
+}
+
+func (tx *ClientTransaction) deliver(resp *sip.Response) {
+	select {
+	case tx.responses <- resp:
+	default:
+	}
+}
+
+// onRetransmit is Timer A, doubling without limit, or Timer E, capped at T2.
+func (tx *ClientTransaction) onRetransmit() {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	switch {
+	case tx.state == TransactionCalling:
+		tx.interval *= 2
+	case tx.state == TransactionTrying:
+		tx.interval = min(2*tx.interval, tx.layer.cfg.t2)
+	case tx.state == TransactionProceeding && !tx.req.IsInvite():
+		tx.interval = tx.layer.cfg.t2
+	default:
+		return
+	}
+
+	tx.layer.cfg.logger.Debug("retransmitting request", "method", tx.req.Method, "branch", tx.branch)
+
+	if err := tx.layer.write(tx.req, tx.addr); err != nil {
+		tx.terminate(fmt.Errorf("retransmitting %s to %s: %w", tx.req.Method, tx.addr, err))
+
+		return
+	}
+
+	tx.retransmit = time.AfterFunc(tx.interval, tx.onRetransmit)
+}
+
+// onTimeout is Timer B or Timer F.
+func (tx *ClientTransaction) onTimeout() {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	timer := "F"
+	if tx.req.IsInvite() {
+		timer = "B"
+	}
+
+	switch tx.state {
+	case TransactionCalling, TransactionTrying, TransactionProceeding:
+		tx.terminate(&TimeoutError{Timer: timer, Method: tx.req.Method, Branch: tx.branch})
+	}
+}
+
+// terminate must be called with mu held.
+func (tx *ClientTransaction) terminate(err error) {
+	if tx.state == TransactionTerminated {
+		return
+	}
+
+	if err != nil {
+		tx.layer.cfg.logger.Debug("client transaction failed", "method", tx.req.Method, "branch", tx.branch, "error", err)
+	}
+
+	tx.state = TransactionTerminated
+	tx.err = err
+
+	stopTimer(tx.retransmit)
+	stopTimer(tx.timeout)
+	stopTimer(tx.wait)
+
+	if tx.final == nil {
+		close(tx.finalized)
+	}
+
+	close(tx.done)
+	tx.layer.removeClient(tx)
+}
+
+// ServerTransaction is a request received by the layer and the responses
+// sent to it. An INVITE one keeps retransmitting its final response until
+// the ACK arrives, including a 2xx as RFC 3261 section 13.3.1.4 asks the
+// UAS core to do. It does not send 100 Trying on its own.
+type ServerTransaction struct {
+	layer  *TransactionLayer
+	key    string
+	branch string
+	req    *sip.Request
+	addr   net.Addr
+	callID string
+	seqNo  uint32
+
+	done chan struct{}
+
+	mu         sync.Mutex
+	state      TransactionState
+	last       *sip.Response
+	err        error
+	interval   time.Duration
+	retransmit *time.Timer
+	timeout    *time.Timer
+	wait       *time.Timer
+	acked      bool
+}
+
+// Request returns the request that created the transaction.
+func (tx *ServerTransaction) Request() *sip.Request {
+	return tx.req
+}
+
+// State returns the current state of the transaction.
+func (tx *ServerTransaction) State() TransactionState {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	return tx.state
+}
+
+// Done is closed when the transaction terminates.
+func (tx *ServerTransaction) Done() <-chan struct{} {
+	return tx.done
+}
+
+// Err returns why the transaction terminated, nil if it ended normally.
+func (tx *ServerTransaction) Err() error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	return tx.err
+}
+
+// Respond sends resp to the address the request came from and applies
+// figures 7 and 8 of RFC 3261.
+func (tx *ServerTransaction) Respond(resp *sip.Response) error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	if tx.state != TransactionTrying && tx.state != TransactionProceeding {
+		return fmt.Errorf("responding %d in state %s: %w", resp.StatusCode, tx.state, ErrTransactionState)
+	}
+
+	if err := tx.layer.write(resp, tx.addr); err != nil {
+		err = fmt.Errorf("sending %d %s response to %s: %w", resp.StatusCode, resp.Reason, tx.addr, err)
+		tx.terminate(err)
+
+		return err
+	}
+
+	tx.last = resp
+
+	if resp.IsProvisional() {
+		tx.state = TransactionProceeding
+
+		return nil
+	}
+
+	t1 := tx.layer.cfg.t1
+
+	if !tx.req.IsInvite() {
+		tx.state = TransactionCompleted
+		tx.wait = time.AfterFunc(64*t1, func() { // Timer J
+			tx.mu.Lock()
+			defer tx.mu.Unlock()
+
+			tx.terminate(nil)
+		})
+
+		return nil
+	}
+
+	tx.state = TransactionCompleted
+	if resp.IsSuccess() {
+		tx.state = TransactionAccepted
+	}
+
+	tx.interval = t1
+	tx.retransmit = time.AfterFunc(tx.interval, tx.onRetransmit) // Timer G
+	// Timer H, or Timer L for a 2xx.
+	tx.timeout = time.AfterFunc(64*t1, func() {
+		tx.mu.Lock()
+		defer tx.mu.Unlock()
+
+		switch tx.state {
+		case TransactionCompleted:
+			tx.terminate(&TimeoutError{Timer: "H", Method: tx.req.Method, Branch: tx.branch})
+		case TransactionAccepted:
+			tx.terminate(nil)
+		}
+	})
+
+	return nil
+}
+
+// receiveRetransmission answers a retransmitted request with the last
+// response sent, if any. Once a 2xx is acknowledged, retransmissions are
+// absorbed until Timer L.
+func (tx *ServerTransaction) receiveRetransmission() {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	if tx.last == nil || tx.acked || tx.state == TransactionConfirmed || tx.state == TransactionTerminated {
+		return
+	}
+
+	if err := tx.layer.write(tx.last, tx.addr); err != nil {
+		tx.terminate(fmt.Errorf("resending %d response to %s: %w", tx.last.StatusCode, tx.addr, err))
+	}
+}
+
+// receiveACK stops the retransmission of the final response of an INVITE
+// transaction. It reports false if the transaction was not waiting for one.
+func (tx *ServerTransaction) receiveACK() bool {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	switch tx.state {
+	case TransactionCompleted:
+		stopTimer(tx.retransmit)
+		stopTimer(tx.timeout)
+
+		tx.state = TransactionConfirmed
+		tx.wait = time.AfterFunc(tx.layer.cfg.t4, func() { // Timer I
+			tx.mu.Lock()
+			defer tx.mu.Unlock()
+
+			tx.terminate(nil)
+		})
+
+		return true
+	case TransactionAccepted:
+		stopTimer(tx.retransmit)
+		tx.acked = true
+
+		return true
+	case TransactionConfirmed:
+		return true
+	}
+
+	return false
+}
+
+// onRetransmit is Timer G, doubling up to T2.
+func (tx *ServerTransaction) onRetransmit() {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	if tx.acked || (tx.state != TransactionCompleted && tx.state != TransactionAccepted) {
+		return
+	}
+
+	tx.layer.cfg.logger.Debug("retransmitting response", "status", tx.last.StatusCode, "branch", tx.branch)
+
+	if err := tx.layer.write(tx.last, tx.addr); err != nil {
+		tx.terminate(fmt.Errorf("retransmitting %d response to %s: %w", tx.last.StatusCode, tx.addr, err))
+
+		return
+	}
+
+	tx.interval = min(2*tx.interval, tx.layer.cfg.t2)
+	tx.retransmit = time.AfterFunc(tx.interval, tx.onRetransmit)
+}
+
+// terminate must be called with mu held.
+func (tx *ServerTransaction) terminate(err error) {
+	if tx.state == TransactionTerminated {
+		return
+	}
+
+	if err != nil {
+		tx.layer.cfg.logger.Debug("server transaction failed", "method", tx.req.Method, "branch", tx.branch, "error", err)
+	}
+
+	tx.state = TransactionTerminated
+	tx.err = err
+
+	stopTimer(tx.retransmit)
+	stopTimer(tx.timeout)
+	stopTimer(tx.wait)
+
+	close(tx.done)
+	tx.layer.removeServer(tx)
+}
+
+// requestBranch returns the branch of the top Via of req.
+func requestBranch(req *sip.Request) (string, error) {
+	via := req.Via()
+	if via == nil {
+		return "", fmt.Errorf("%s without Via: %w", req.Method, ErrNoBranch)
+	}
+
+	branch, ok := via.Params.Get(branchParam)
+	if !ok || !strings.HasPrefix(branch, sip.RFC3261BranchMagicCookie) {
+		return "", fmt.Errorf("%s with Via %s: %w", req.Method, via.Value(), ErrNoBranch)
+	}
+
+	return branch, nil
+}
+
+// transactionKey follows RFC 3261 sections 17.1.3 and 17.2.3; CANCEL has
+// the branch of the request it cancels but is a transaction of its own.
+func transactionKey(branch, sentBy string, method sip.RequestMethod) string {
+	return branch + "|" + sentBy + "|" + string(method)
+}
+
+func stopTimer(timer *time.Timer) {
+	if timer != nil {
+		timer.Stop()
+	}
+}
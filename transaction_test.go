@@ -0,0 +1,212 @@
+package sdp
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/emiago/sipgo/sip"
+)
+
+const (
+	testT1 = 5 * time.Millisecond
+	testT2 = 20 * time.Millisecond
+	testT4 = 50 * time.Millisecond
+)
+
+// recordingConn is a net.PacketConn that counts what is written to it.
+type recordingConn struct {
+	net.PacketConn
+
+	mu     sync.Mutex
+	writes int
+}
+
+func (c *recordingConn) WriteTo(p []byte, _ net.Addr) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.writes++
+
+	return len(p), nil
+}
+
+func (c *recordingConn) count() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.writes
+}
+
+func testRequest(method sip.RequestMethod, branch string) *sip.Request {
+	req := sip.NewRequest(method, sip.Uri{Scheme: "sip", User: "bob", Host: "127.0.0.1", Port: 5060})
+
+	via := &sip.ViaHeader{
+		ProtocolName:    "SIP",
+		ProtocolVersion: "2.0",
+		Transport:       "UDP",
+		Host:            "127.0.0.1",
+		Port:            5070,
+		Params:          sip.NewParams(),
+	}
+	via.Params.Add(branchParam, branch)
+
+	callID := sip.CallIDHeader("test-call-id")
+
+	req.AppendHeader(via)
+	req.AppendHeader(&sip.FromHeader{Address: sip.Uri{Scheme: "sip", User: "alice", Host: "127.0.0.1"}, Params: sip.NewParams()})
+	req.AppendHeader(&sip.ToHeader{Address: sip.Uri{Scheme: "sip", User: "bob", Host: "127.0.0.1"}, Params: sip.NewParams()})
+	req.AppendHeader(&callID)
+	req.AppendHeader(&sip.CSeqHeader{SeqNo: 1, MethodName: method})
+
+	return req
+}
+
+func waitDone(t *testing.T, done <-chan struct{}) {
+	t.Helper()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("transaction did not terminate")
+	}
+}
+
+func TestClientTransactionTimers(t *testing.T) {
+	addr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 5060}
+
+	tests := []struct {
+		name   string
+		method sip.RequestMethod
+		status int
+		timer  string
+		state  TransactionState
+	}{
+		{name: "INVITE without response", method: sip.INVITE, timer: "B"},
+		{name: "BYE without response", method: sip.BYE, timer: "F"},
+		{name: "INVITE rejected", method: sip.INVITE, status: sip.StatusBusyHere, state: TransactionCompleted},
+		{name: "BYE answered", method: sip.BYE, status: sip.StatusOK, state: TransactionCompleted},
+		{name: "INVITE accepted", method: sip.INVITE, status: sip.StatusOK, state: TransactionTerminated},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := &recordingConn{}
+			layer := NewTransactionLayer(conn, WithTransactionTimers(testT1, testT2, testT4))
+
+			req := testRequest(tt.method, sip.GenerateBranch())
+
+			tx, err := layer.Request(req, addr)
+			if err != nil {
+				t.Fatalf("Request: %v", err)
+			}
+
+			if tt.status == 0 {
+				waitDone(t, tx.Done())
+
+				var timeout *TimeoutError
+				if !errors.As(tx.Err(), &timeout) || timeout.Timer != tt.timer {
+					t.Fatalf("Err() = %v, want timer %s", tx.Err(), tt.timer)
+				}
+
+				if conn.count() < 2 {
+					t.Fatalf("sent %d times, want retransmissions", conn.count())
+				}
+
+				return
+			}
+
+			if !layer.HandleResponse(sip.NewResponseFromRequest(req, tt.status, "", nil)) {
+				t.Fatal("response matched no transaction")
+			}
+
+			if got := tx.State(); got != tt.state {
+				t.Fatalf("State() = %s, want %s", got, tt.state)
+			}
+
+			waitDone(t, tx.Done())
+
+			if tx.Err() != nil {
+				t.Fatalf("Err() = %v, want nil", tx.Err())
+			}
+		})
+	}
+}
+
+func TestServerTransactionTimers(t *testing.T) {
+	addr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 5070}
+
+	tests := []struct {
+		name    string
+		method  sip.RequestMethod
+		status  int
+		ack     bool
+		state   TransactionState
+		timeout bool
+	}{
+		{name: "INVITE rejected without ACK", method: sip.INVITE, status: sip.StatusBusyHere, state: TransactionCompleted, timeout: true},
+		{name: "INVITE rejected and ACKed", method: sip.INVITE, status: sip.StatusBusyHere, ack: true, state: TransactionConfirmed},
+		{name: "INVITE accepted without ACK", method: sip.INVITE, status: sip.StatusOK, state: TransactionAccepted},
+		{name: "INVITE accepted and ACKed", method: sip.INVITE, status: sip.StatusOK, ack: true, state: TransactionAccepted},
+		{name: "BYE answered", method: sip.BYE, status: sip.StatusOK, state: TransactionCompleted},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := &recordingConn{}
+			layer := NewTransactionLayer(conn, WithTransactionTimers(testT1, testT2, testT4))
+
+			branch := sip.GenerateBranch()
+			req := testRequest(tt.method, branch)
+
+			tx, isNew := layer.HandleRequest(req, addr)
+			if tx == nil || !isNew {
+				t.Fatalf("HandleRequest = %v, %v, want a new transaction", tx, isNew)
+			}
+
+			resp := sip.NewResponseFromRequest(req, tt.status, "", nil)
+			if err := tx.Respond(resp); err != nil {
+				t.Fatalf("Respond: %v", err)
+			}
+
+			if tt.ack {
+				ack := testRequest(sip.ACK, branch)
+				if tt.status == sip.StatusOK {
+					ack = testRequest(sip.ACK, sip.GenerateBranch())
+				}
+
+				if _, pass := layer.HandleRequest(ack, addr); pass {
+					t.Fatal("ACK was not absorbed by the transaction")
+				}
+
+				sent := conn.count()
+				if _, pass := layer.HandleRequest(req, addr); pass {
+					t.Fatal("retransmitted request was passed on")
+				}
+
+				time.Sleep(4 * testT1)
+
+				if tt.status == sip.StatusOK && conn.count() != sent {
+					t.Fatalf("sent %d responses after the ACK, want none", conn.count()-sent)
+				}
+			}
+
+			if got := tx.State(); got != tt.state {
+				t.Fatalf("State() = %s, want %s", got, tt.state)
+			}
+
+			waitDone(t, tx.Done())
+
+			var timeout *TimeoutError
+			if isTimeout := errors.As(tx.Err(), &timeout); isTimeout != tt.timeout {
+				t.Fatalf("Err() = %v, want timeout %v", tx.Err(), tt.timeout)
+			}
+
+			if tt.timeout && timeout.Timer != "H" {
+				t.Fatalf("timer %s fired, want H", timeout.Timer)
+			}
+		})
+	}
+}
@@ -0,0 +1,184 @@
+package sdp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pion/sdp/v4"
+)
+
+const (
+	networkTypeIN = "IN"
+	addrTypeIP4   = "IP4"
+	addrTypeIP6   = "IP6"
+	// resolveTimeout bounds the DNS lookups of the addresses of one m= line.
+	resolveTimeout = 2 * time.Second
+)
+
+var (
+	// ErrRejectedStream is returned for an m= line with port 0.
+	ErrRejectedStream = errors.New("stream rejected with port 0")
+	// ErrNoConnectionAddress is returned when neither the m= line nor the
+	// session has a c= line, and the o= line has no address either.
+	ErrNoConnectionAddress = errors.New("no connection address")
+	// ErrMalformedAddress is wrapped by AddressError.
+	ErrMalformedAddress = errors.New("malformed address")
+)
+
+// AddressError describes a c= line, o= address or a=rtcp attribute that
+// cannot be used.
+type AddressError struct {
+	Field string // "c", "o" or "a=rtcp"
+	Value string
+	Err   error
+}
+
+func (e *AddressError) Error() string {
+	return fmt.Sprintf("%s %q: %v", e.Field, e.Value, e.Err)
+}
+
+func (e *AddressError) Unwrap() error {
+	return e.Err
+}
+
+// ResolveRemoteTransport returns where to send RTP and RTCP for the m= line
+// at index of a remote description. RTCP goes to the RTP address when
+// rtcp-mux is present.
+func ResolveRemoteTransport(body []byte, index int) (*net.UDPAddr, *net.UDPAddr, error) {
+	desc, err := unmarshalSDP(body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unmarshaling SDP: %w", err)
+	}
+
+	if index < 0 || index >= len(desc.MediaDescriptions) {
+		return nil, nil, fmt.Errorf("no m= line %d in SDP", index)
+	}
+
+	md := desc.MediaDescriptions[index]
+
+	return resolveRemoteTransport(desc, md, hasRTCPMux(md))
+}
+
+// resolveRemoteTransport applies RFC 4566 section 5.7, where a media level
+// c= line overrides the session one, and RFC 3605: without a=rtcp RTCP goes
+// to the next port, and an a=rtcp without address uses the c= one. Without
+// any c= line the o= address is used, as older endpoints expect. Domain
+// names are looked up within resolveTimeout.
+func resolveRemoteTransport(desc *sdp.SessionDescription, md *sdp.MediaDescription, rtcpMux bool) (*net.UDPAddr, *net.UDPAddr, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), resolveTimeout)
+	defer cancel()
+
+	port := md.MediaName.Port.Value
+	if port == 0 {
+		return nil, nil, ErrRejectedStream
+	}
+
+	if port < 0 || port > 65535 {
+		return nil, nil, &AddressError{Field: "m", Value: strconv.Itoa(port), Err: ErrMalformedAddress}
+	}
+
+	connInfo := desc.ConnectionInformation
+	if md.ConnectionInformation != nil {
+		connInfo = md.ConnectionInformation
+	}
+
+	field, networkType, addrType, address := "c", "", "", ""
+
+	switch {
+	case connInfo != nil && connInfo.Address != nil:
+		networkType, addrType, address = connInfo.NetworkType, connInfo.AddressType, connInfo.Address.Address
+	case desc.Origin.UnicastAddress != "":
+		field = "o"
+		networkType, addrType, address = desc.Origin.NetworkType, desc.Origin.AddressType, desc.Origin.UnicastAddress
+	default:
+		return nil, nil, ErrNoConnectionAddress
+	}
+
+	ip, err := resolveConnectionAddress(ctx, networkType, addrType, address)
+	if err != nil {
+		return nil, nil, &AddressError{Field: field, Value: strings.Join([]string{networkType, addrType, address}, " "), Err: err}
+	}
+
+	addrRTP := &net.UDPAddr{IP: ip, Port: port}
+	if rtcpMux {
+		return addrRTP, &net.UDPAddr{IP: ip, Port: port}, nil
+	}
+
+	value, ok := md.Attribute(rtcpHeader)
+	if !ok {
+		return addrRTP, &net.UDPAddr{IP: ip, Port: port + 1}, nil
+	}
+
+	addrRTCP, err := parseRTCPAttribute(ctx, value, ip)
+	if err != nil {
+		return nil, nil, &AddressError{Field: "a=rtcp", Value: value, Err: err}
+	}
+
+	return addrRTP, addrRTCP, nil
+}
+
+// parseRTCPAttribute reads "port [nettype addrtype address]", using ip when
+// there is no address.
+func parseRTCPAttribute(ctx context.Context, value string, ip net.IP) (*net.UDPAddr, error) {
+	fields := strings.Fields(value)
+	if len(fields) != 1 && len(fields) != 4 {
+		return nil, ErrMalformedAddress
+	}
+
+	port, err := strconv.Atoi(fields[0])
+	if err != nil || port <= 0 || port > 65535 {
+		return nil, fmt.Errorf("%w: port %s", ErrMalformedAddress, fields[0])
+	}
+
+	if len(fields) == 4 {
+		if ip, err = resolveConnectionAddress(ctx, fields[1], fields[2], fields[3]); err != nil {
+			return nil, err
+		}
+	}
+
+	return &net.UDPAddr{IP: ip, Port: port}, nil
+}
+
+// resolveConnectionAddress parses an IP4 or IP6 address, dropping any
+// multicast TTL or count, or looks it up when it is a domain name.
+func resolveConnectionAddress(ctx context.Context, networkType, addrType, address string) (net.IP, error) {
+	if networkType != networkTypeIN {
+		return nil, fmt.Errorf("%w: network type %s", ErrMalformedAddress, networkType)
+	}
+
+	network := ""
+
+	switch addrType {
+	case addrTypeIP4:
+		network = "ip4"
+	case addrTypeIP6:
+		network = "ip6"
+	default:
+		return nil, fmt.Errorf("%w: address type %s", ErrMalformedAddress, addrType)
+	}
+
+	host, _, _ := strings.Cut(address, "/")
+	if host == "" {
+		return nil, fmt.Errorf("%w: empty address", ErrMalformedAddress)
+	}
+
+	if ip := net.ParseIP(host); ip != nil {
+		if (ip.To4() != nil) != (addrType == addrTypeIP4) {
+			return nil, fmt.Errorf("%w: %s is not an %s address", ErrMalformedAddress, host, addrType)
+		}
+
+		return ip, nil
+	}
+
+	ips, err := net.DefaultResolver.LookupIP(ctx, network, host)
+	if err != nil {
+		return nil, fmt.Errorf("resolving %s: %w", host, err)
+	}
+
+	return ips[0], nil
+}
@@ -0,0 +1,113 @@
+package sdp
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestResolveRemoteTransport(t *testing.T) {
+	body := func(lines ...string) []byte {
+		return []byte(strings.Join(lines, "\r\n") + "\r\n")
+	}
+
+	const (
+		version = "v=0"
+		origin  = "o=- 1 1 IN IP4 10.1.2.3"
+		session = "s=-"
+		timing  = "t=0 0"
+	)
+
+	tests := []struct {
+		name     string
+		body     []byte
+		wantRTP  string
+		wantRTCP string
+		wantErr  error
+	}{
+		{
+			name:     "session c= and next port for RTCP",
+			body:     body(version, origin, session, "c=IN IP4 192.0.2.1", timing, "m=audio 5000 RTP/AVP 0"),
+			wantRTP:  "192.0.2.1:5000",
+			wantRTCP: "192.0.2.1:5001",
+		},
+		{
+			name:     "media c= overrides session c=",
+			body:     body(version, origin, session, "c=IN IP4 192.0.2.1", timing, "m=audio 5000 RTP/AVP 0", "c=IN IP4 192.0.2.2"),
+			wantRTP:  "192.0.2.2:5000",
+			wantRTCP: "192.0.2.2:5001",
+		},
+		{
+			name:     "IPv6",
+			body:     body(version, origin, session, timing, "m=audio 5000 RTP/AVP 0", "c=IN IP6 2001:db8::1"),
+			wantRTP:  "[2001:db8::1]:5000",
+			wantRTCP: "[2001:db8::1]:5001",
+		},
+		{
+			name:     "a=rtcp with a port only",
+			body:     body(version, origin, session, "c=IN IP4 192.0.2.1", timing, "m=audio 5000 RTP/AVP 0", "a=rtcp:6000"),
+			wantRTP:  "192.0.2.1:5000",
+			wantRTCP: "192.0.2.1:6000",
+		},
+		{
+			name:     "a=rtcp with an address",
+			body:     body(version, origin, session, "c=IN IP4 192.0.2.1", timing, "m=audio 5000 RTP/AVP 0", "a=rtcp:6000 IN IP4 198.51.100.7"),
+			wantRTP:  "192.0.2.1:5000",
+			wantRTCP: "198.51.100.7:6000",
+		},
+		{
+			name:     "rtcp-mux",
+			body:     body(version, origin, session, "c=IN IP4 192.0.2.1", timing, "m=audio 5000 RTP/AVP 0", "a=rtcp:6000", "a=rtcp-mux"),
+			wantRTP:  "192.0.2.1:5000",
+			wantRTCP: "192.0.2.1:5000",
+		},
+		{
+			name:     "o= address without c=",
+			body:     body(version, origin, session, timing, "m=audio 4000 RTP/AVP 0"),
+			wantRTP:  "10.1.2.3:4000",
+			wantRTCP: "10.1.2.3:4001",
+		},
+		{
+			name:    "rejected stream",
+			body:    body(version, origin, session, "c=IN IP4 192.0.2.1", timing, "m=audio 0 RTP/AVP 0"),
+			wantErr: ErrRejectedStream,
+		},
+		{
+			name:    "IPv6 address in an IP4 c=",
+			body:    body(version, origin, session, "c=IN IP4 2001:db8::1", timing, "m=audio 5000 RTP/AVP 0"),
+			wantErr: ErrMalformedAddress,
+		},
+		{
+			name:    "malformed a=rtcp",
+			body:    body(version, origin, session, "c=IN IP4 192.0.2.1", timing, "m=audio 5000 RTP/AVP 0", "a=rtcp:port"),
+			wantErr: ErrMalformedAddress,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addrRTP, addrRTCP, err := ResolveRemoteTransport(tt.body, 0)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("ResolveRemoteTransport() error = %v, want %v", err, tt.wantErr)
+				}
+
+				var addrErr *AddressError
+				if errors.Is(tt.wantErr, ErrMalformedAddress) && !errors.As(err, &addrErr) {
+					t.Fatalf("ResolveRemoteTransport() error = %T, want *AddressError", err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("ResolveRemoteTransport: %v", err)
+			}
+
+			if addrRTP.String() != tt.wantRTP || addrRTCP.String() != tt.wantRTCP {
+				t.Fatalf("ResolveRemoteTransport() = %s, %s, want %s, %s", addrRTP, addrRTCP, tt.wantRTP, tt.wantRTCP)
+			}
+		})
+	}
+
+}
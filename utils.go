@@ -25,6 +25,16 @@ func WriteResponse(param Param) error {
 		return fmt.Errorf("failed to send %d %s response: %w", resp.StatusCode, resp.Reason, err)
 	}
 
+	cseq, callID := messageIDs(resp)
+	defaultLogger().Debug("sent SIP response",
+		"status", resp.StatusCode,
+		"reason", resp.Reason,
+		"cseq", cseq,
+		"call_id", callID,
+		"to", addr,
+		"bytes", len(payload),
+	)
+
 	return nil
 }
 
@@ -39,5 +49,29 @@ func WriteRequest(param Param) error {
 		return fmt.Errorf("failed to send request: %w", err)
 	}
 
+	cseq, callID := messageIDs(req)
+	defaultLogger().Debug("sent SIP request",
+		"method", req.Method,
+		"uri", req.Recipient.String(),
+		"cseq", cseq,
+		"call_id", callID,
+		"to", addr,
+		"bytes", len(payload),
+	)
+
 	return nil
 }
+
+// messageIDs returns the CSeq and Call-ID values of msg, "" for a missing one.
+func messageIDs(msg sip.Message) (string, string) {
+	cseq, callID := "", ""
+	if h := msg.CSeq(); h != nil {
+		cseq = h.Value()
+	}
+
+	if h := msg.CallID(); h != nil {
+		callID = h.Value()
+	}
+
+	return cseq, callID
+}
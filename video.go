@@ -0,0 +1,134 @@
+package sdp
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	h264                      = "H264"
+	h264ProfileLevelID        = "profile-level-id"
+	h264PacketizationMode     = "packetization-mode"
+	h264DefaultProfileLevelID = "42000a" // constrained baseline, level 1, RFC 6184 section 8.1
+)
+
+// DefaultVideoCodecs returns the video codecs the package knows how to
+// describe. They are not in DefaultCodecRegistry so that audio-only calls
+// keep offering a single m= line; register them to bridge video.
+func DefaultVideoCodecs() []Codec {
+	feedback := []string{"nack", "nack pli", "ccm fir"}
+
+	return []Codec{
+		{
+			Media:        mediaVideo,
+			Name:         h264,
+			PayloadType:  102,
+			ClockRate:    90000,
+			Channels:     1,
+			Fmtp:         "profile-level-id=42e01f;level-asymmetry-allowed=1;packetization-mode=1",
+			RTCPFeedback: feedback,
+		},
+		{
+			Media:        mediaVideo,
+			Name:         h264,
+			PayloadType:  104,
+			ClockRate:    90000,
+			Channels:     1,
+			Fmtp:         "profile-level-id=42e01f;level-asymmetry-allowed=1;packetization-mode=0",
+			RTCPFeedback: feedback,
+		},
+		{
+			Media:        mediaVideo,
+			Name:         "VP8",
+			PayloadType:  98,
+			ClockRate:    90000,
+			Channels:     1,
+			RTCPFeedback: feedback,
+		},
+	}
+}
+
+func isH264(codec Codec) bool {
+	return strings.EqualFold(codec.Name, h264)
+}
+
+// parseFmtp splits "a=1;b=2" into its parameters, keys lowercased.
+func parseFmtp(fmtp string) map[string]string {
+	params := map[string]string{}
+
+	for _, param := range strings.Split(fmtp, ";") {
+		key, value, _ := strings.Cut(param, "=")
+		if key = strings.TrimSpace(key); key != "" {
+			params[strings.ToLower(key)] = strings.TrimSpace(value)
+		}
+	}
+
+	return params
+}
+
+// h264Params returns the profile (profile_idc and profile-iop), the level
+// and the packetization mode of an H.264 fmtp line, with RFC 6184 defaults.
+func h264Params(fmtp string) (string, uint64, string) {
+	params := parseFmtp(fmtp)
+
+	profileLevelID := params[h264ProfileLevelID]
+	if len(profileLevelID) != 6 {
+		profileLevelID = h264DefaultProfileLevelID
+	}
+
+	level, err := strconv.ParseUint(profileLevelID[4:], 16, 8)
+	if err != nil {
+		level = 0
+	}
+
+	mode := params[h264PacketizationMode]
+	if mode == "" {
+		mode = "0"
+	}
+
+	return strings.ToLower(profileLevelID[:4]), level, mode
+}
+
+// h264Compatible reports whether two H.264 formats share profile and
+// packetization mode, which RFC 6184 requires for them to be the same format.
+func h264Compatible(local, remote string) bool {
+	localProfile, _, localMode := h264Params(local)
+	remoteProfile, _, remoteMode := h264Params(remote)
+
+	return localProfile == remoteProfile && localMode == remoteMode
+}
+
+// answerH264Fmtp answers with the local parameters, lowering the level to
+// the remote one unless the remote allows level asymmetry.
+func answerH264Fmtp(local, remote string) string {
+	profile, localLevel, _ := h264Params(local)
+	_, remoteLevel, _ := h264Params(remote)
+
+	if parseFmtp(remote)["level-asymmetry-allowed"] == "1" || remoteLevel >= localLevel {
+		return local
+	}
+
+	params := strings.Split(local, ";")
+	for i, param := range params {
+		key, _, _ := strings.Cut(strings.TrimSpace(param), "=")
+		if strings.EqualFold(key, h264ProfileLevelID) {
+			params[i] = fmt.Sprintf("%s=%s%02x", h264ProfileLevelID, profile, remoteLevel)
+		}
+	}
+
+	return strings.Join(params, ";")
+}
+
+// intersectFeedback keeps the local rtcp-fb values the remote also listed.
+func intersectFeedback(local, remote []string) []string {
+	feedback := []string{}
+	for _, value := range local {
+		if slices.Contains(remote, value) {
+			feedback = append(feedback, value)
+		}
+	}
+
+	return feedback
+}
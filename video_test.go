@@ -0,0 +1,26 @@
+package sdp
+
+import (
+	"maps"
+	"testing"
+)
+
+func TestParseFmtp(t *testing.T) {
+	tests := []struct {
+		fmtp string
+		want map[string]string
+	}{
+		{fmtp: "", want: map[string]string{}},
+		{fmtp: "0-15", want: map[string]string{"0-15": ""}},
+		{fmtp: "minptime=10;useinbandfec=1", want: map[string]string{"minptime": "10", "useinbandfec": "1"}},
+		{fmtp: " Profile-Level-Id = 42e01f ; packetization-mode=1;", want: map[string]string{"profile-level-id": "42e01f", "packetization-mode": "1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.fmtp, func(t *testing.T) {
+			if got := parseFmtp(tt.fmtp); !maps.Equal(got, tt.want) {
+				t.Fatalf("parseFmtp(%q) = %v, want %v", tt.fmtp, got, tt.want)
+			}
+		})
+	}
+}